@@ -0,0 +1,122 @@
+package integrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/databricks/databricks-sql-go/auth"
+	"golang.org/x/oauth2"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AzureDatabricksResourceID is the application ID of the Azure Databricks resource in Entra ID.
+const AzureDatabricksResourceID = "2ff814a6-3304-4ab8-85cb-cd0e6f879c1d"
+
+// AzureIMDSEndpoint is the token endpoint of the Azure instance metadata service.
+const AzureIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// imdsClient connects to the instance metadata service directly, the link-local endpoint is never reachable
+// through a proxy.
+var imdsClient = &http.Client{
+	Transport: &http.Transport{Proxy: nil},
+	Timeout:   30 * time.Second,
+}
+
+// azureManagedIdentity fetches Entra tokens for Azure Databricks from the instance metadata service.
+type azureManagedIdentity struct {
+	endpoint string
+	clientID string
+	client   *http.Client
+}
+
+type imdsTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   string `json:"expires_in"`
+	ExpiresOn   string `json:"expires_on"`
+}
+
+func (m *azureManagedIdentity) Token() (*oauth2.Token, error) {
+	endpoint, err := url.Parse(m.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid managed identity endpoint: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", AzureDatabricksResourceID)
+	if m.clientID != "" {
+		// User-assigned identity, without a client ID the system-assigned identity is used
+		query.Set("client_id", m.clientID)
+	}
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("managed identity token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("managed identity token response could not be read: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp tokenErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("managed identity token request failed with status %d: %s: %s", resp.StatusCode, errResp.Error, errResp.ErrorDescription)
+		}
+		return nil, fmt.Errorf("managed identity token request failed with status %d", resp.StatusCode)
+	}
+
+	var tokenResp imdsTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("managed identity token response could not be parsed: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("managed identity token response contains no access token")
+	}
+
+	return &oauth2.Token{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
+		Expiry:      imdsTokenExpiry(tokenResp, time.Now()),
+	}, nil
+}
+
+// imdsTokenExpiry returns the expiry of an IMDS token, which is returned as epoch (expires_on) and as
+// seconds from now (expires_in), both as strings.
+func imdsTokenExpiry(tokenResp imdsTokenResponse, now time.Time) time.Time {
+	if expiresOn, err := strconv.ParseInt(tokenResp.ExpiresOn, 10, 64); err == nil {
+		return time.Unix(expiresOn, 0)
+	}
+	if expiresIn, err := strconv.ParseInt(tokenResp.ExpiresIn, 10, 64); err == nil {
+		return now.Add(time.Duration(expiresIn) * time.Second)
+	}
+	return time.Time{}
+}
+
+// NewAzureManagedIdentity returns an authenticator using the managed identity of the Azure VM or AKS node.
+// clientID selects a user-assigned identity, if empty the system-assigned identity is used. If endpoint is
+// empty, the Azure instance metadata service is used. Without client, the endpoint is connected directly.
+func NewAzureManagedIdentity(clientID string, endpoint string, client *http.Client) auth.Authenticator {
+	if endpoint == "" {
+		endpoint = AzureIMDSEndpoint
+	}
+	if client == nil {
+		client = imdsClient
+	}
+	return newTokenSourceAuthenticator("azure_managed_identity", &azureManagedIdentity{
+		endpoint: endpoint,
+		clientID: clientID,
+		client:   client,
+	})
+}
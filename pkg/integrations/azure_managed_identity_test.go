@@ -0,0 +1,131 @@
+package integrations
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkIMDSRequest verifies a token request of the managed identity with the optional clientID.
+func checkIMDSRequest(clientID string) func(r *http.Request) error {
+	return func(r *http.Request) error {
+		query := r.URL.Query()
+		switch {
+		case r.Method != http.MethodGet:
+			return fmt.Errorf("expected GET, got %s", r.Method)
+		case r.Header.Get("Metadata") != "true":
+			return fmt.Errorf("expected Metadata: true header, got %q", r.Header.Get("Metadata"))
+		case query.Get("resource") != AzureDatabricksResourceID:
+			return fmt.Errorf("expected resource %s, got %q", AzureDatabricksResourceID, query.Get("resource"))
+		case query.Get("api-version") == "":
+			return fmt.Errorf("expected api-version parameter")
+		case clientID == "" && query.Has("client_id"):
+			return fmt.Errorf("expected no client_id for the system-assigned identity, got %q", query.Get("client_id"))
+		case clientID != "" && query.Get("client_id") != clientID:
+			return fmt.Errorf("expected client_id %s, got %q", clientID, query.Get("client_id"))
+		}
+		return nil
+	}
+}
+
+func TestAzureManagedIdentity(t *testing.T) {
+	for name, clientID := range map[string]string{
+		"system-assigned": "",
+		"user-assigned":   "11111111-2222-3333-4444-555555555555",
+	} {
+		t.Run(name, func(t *testing.T) {
+			imds := newTokenEndpoint(t, checkIMDSRequest(clientID), func(w http.ResponseWriter, call int32) {
+				_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":"3599","expires_on":"%d"}`,
+					call, time.Now().Add(time.Hour).Unix())
+			})
+			authenticator := NewAzureManagedIdentity(clientID, imds.srv.URL, imds.srv.Client())
+
+			for i := 0; i < 3; i++ {
+				header, err := authorization(t, authenticator.Authenticate)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if header != "Bearer token-1" {
+					t.Fatalf("expected cached token, got %q", header)
+				}
+			}
+			if calls := imds.calls.Load(); calls != 1 {
+				t.Fatalf("expected the token to be reused, got %d requests", calls)
+			}
+		})
+	}
+}
+
+func TestAzureManagedIdentityRefreshesBeforeExpiry(t *testing.T) {
+	imds := newTokenEndpoint(t, checkIMDSRequest(""), func(w http.ResponseWriter, call int32) {
+		// Expires within tokenExpiryDelta, so it is never reused
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_on":"%d"}`,
+			call, time.Now().Add(tokenExpiryDelta-time.Minute).Unix())
+	})
+	authenticator := NewAzureManagedIdentity("", imds.srv.URL, imds.srv.Client())
+
+	for i := 1; i <= 2; i++ {
+		header, err := authorization(t, authenticator.Authenticate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("Bearer token-%d", i); header != want {
+			t.Fatalf("expected %q, got %q", want, header)
+		}
+	}
+	if calls := imds.calls.Load(); calls != 2 {
+		t.Fatalf("expected a new token for every request, got %d requests", calls)
+	}
+}
+
+func TestAzureManagedIdentityError(t *testing.T) {
+	imds := newTokenEndpoint(t, checkIMDSRequest(""), func(w http.ResponseWriter, call int32) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"error":"invalid_request","error_description":"Identity not found"}`)
+	})
+	authenticator := NewAzureManagedIdentity("", imds.srv.URL, imds.srv.Client())
+
+	_, err := authorization(t, authenticator.Authenticate)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, part := range []string{"400", "invalid_request", "Identity not found"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("expected error to contain %q, got %q", part, err)
+		}
+	}
+}
+
+func TestAzureManagedIdentityMissingToken(t *testing.T) {
+	imds := newTokenEndpoint(t, checkIMDSRequest(""), func(w http.ResponseWriter, call int32) {
+		_, _ = fmt.Fprint(w, `{"token_type":"Bearer"}`)
+	})
+	authenticator := NewAzureManagedIdentity("", imds.srv.URL, imds.srv.Client())
+
+	if _, err := authorization(t, authenticator.Authenticate); err == nil {
+		t.Fatal("expected an error for a response without access token")
+	}
+}
+
+func TestIMDSTokenExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		response imdsTokenResponse
+		want     time.Time
+	}{
+		{"expires_on", imdsTokenResponse{ExpiresOn: "1700003600", ExpiresIn: "60"}, time.Unix(1700003600, 0)},
+		{"expires_in", imdsTokenResponse{ExpiresIn: "3599"}, now.Add(3599 * time.Second)},
+		{"invalid expires_on", imdsTokenResponse{ExpiresOn: "tomorrow", ExpiresIn: "120"}, now.Add(120 * time.Second)},
+		{"none", imdsTokenResponse{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imdsTokenExpiry(tt.response, now); !got.Equal(tt.want) {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
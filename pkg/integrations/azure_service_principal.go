@@ -0,0 +1,87 @@
+package integrations
+
+import (
+	"fmt"
+	"github.com/databricks/databricks-sql-go/auth"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// AzureAuthorityHost is the Entra login endpoint of the Azure public cloud.
+const AzureAuthorityHost = "https://login.microsoftonline.com"
+
+var (
+	azureGUIDPattern   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	azureDomainPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)+$`)
+)
+
+// AzureDatabricksScope returns the scope of the Azure Databricks resource.
+func AzureDatabricksScope() string {
+	return AzureDatabricksResourceID + "/.default"
+}
+
+// AzureTokenUrl returns the Entra token endpoint of tenantID.
+func AzureTokenUrl(tenantID string) string {
+	return fmt.Sprintf("%s/%s/oauth2/v2.0/token", AzureAuthorityHost, tenantID)
+}
+
+// ValidateAzureTenantID checks that tenantID is a GUID or a domain name, i.e. contoso.onmicrosoft.com.
+func ValidateAzureTenantID(tenantID string) error {
+	if tenantID == "" {
+		return fmt.Errorf("azure tenant id is missing")
+	}
+	if !azureGUIDPattern.MatchString(tenantID) && !azureDomainPattern.MatchString(tenantID) {
+		return fmt.Errorf("azure tenant id %q is neither a GUID nor a domain name", tenantID)
+	}
+	return nil
+}
+
+// ValidateAzureClientID checks that clientID is the GUID of an application.
+func ValidateAzureClientID(clientID string) error {
+	if clientID == "" {
+		return fmt.Errorf("azure client id is missing")
+	}
+	if !azureGUIDPattern.MatchString(clientID) {
+		return fmt.Errorf("azure client id %q is not a GUID (application id of the service principal)", clientID)
+	}
+	return nil
+}
+
+type azureServicePrincipal struct {
+	config clientcredentials.Config
+	client *http.Client
+}
+
+func (a *azureServicePrincipal) Token() (*oauth2.Token, error) {
+	return a.config.Token(httpClientContext(a.client))
+}
+
+// NewAzureServicePrincipal returns an authenticator fetching Entra tokens for Azure Databricks with the client
+// secret of a service principal. Every input is validated separately.
+func NewAzureServicePrincipal(tenantID, clientID, clientSecret string, client *http.Client) (auth.Authenticator, error) {
+	tenantID = strings.TrimSpace(tenantID)
+	clientID = strings.TrimSpace(clientID)
+	if err := ValidateAzureTenantID(tenantID); err != nil {
+		return nil, err
+	}
+	if err := ValidateAzureClientID(clientID); err != nil {
+		return nil, err
+	}
+	if clientSecret == "" {
+		return nil, fmt.Errorf("azure client secret is missing")
+	}
+
+	return newTokenSourceAuthenticator("azure_service_principal", &azureServicePrincipal{
+		config: clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     AzureTokenUrl(tenantID),
+			Scopes:       []string{AzureDatabricksScope()},
+			AuthStyle:    oauth2.AuthStyleInParams,
+		},
+		client: client,
+	}), nil
+}
@@ -0,0 +1,224 @@
+package integrations
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/databricks/databricks-sql-go/auth"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// clientAssertionLifetime is the validity of a signed client assertion, a new one is signed for every token request.
+const clientAssertionLifetime = 5 * time.Minute
+
+// clientAssertionSigner signs JWT client assertions (RFC 7523) with an RSA or EC private key. If a certificate
+// is configured, its SHA-1 and SHA-256 thumbprints are added as x5t and x5t#S256 header, as required by Entra.
+type clientAssertionSigner struct {
+	key     crypto.Signer
+	alg     string
+	hash    crypto.Hash
+	kid     string
+	x5t     string
+	x5tS256 string
+}
+
+// newClientAssertionSigner parses a PEM encoded private key (PKCS#8, PKCS#1 or SEC 1) and an optional PEM
+// encoded certificate of the key.
+func newClientAssertionSigner(privateKey, certificate string) (*clientAssertionSigner, error) {
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &clientAssertionSigner{key: key}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signer.alg, signer.hash = "RS256", crypto.SHA256
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			signer.alg, signer.hash = "ES256", crypto.SHA256
+		case elliptic.P384():
+			signer.alg, signer.hash = "ES384", crypto.SHA384
+		case elliptic.P521():
+			signer.alg, signer.hash = "ES512", crypto.SHA512
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T, only RSA and EC keys are supported", key)
+	}
+
+	if certificate != "" {
+		cert, err := parseCertificate(certificate)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !publicKey.Equal(cert.PublicKey) {
+			return nil, fmt.Errorf("certificate does not match the private key")
+		}
+		sha1Sum := sha1.Sum(cert.Raw)
+		sha256Sum := sha256.Sum256(cert.Raw)
+		signer.x5t = base64.RawURLEncoding.EncodeToString(sha1Sum[:])
+		signer.x5tS256 = base64.RawURLEncoding.EncodeToString(sha256Sum[:])
+	}
+	return signer, nil
+}
+
+func parsePrivateKey(privateKey string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("private key could not be parsed, expected PKCS#8, PKCS#1 or EC private key")
+}
+
+func parseCertificate(certificate string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("certificate could not be parsed: %w", err)
+	}
+	return cert, nil
+}
+
+// sign returns a client assertion issued by clientID for the token endpoint audience.
+func (s *clientAssertionSigner) sign(clientID, audience string, now time.Time) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	return s.signClaims(map[string]interface{}{
+		"iss": clientID,
+		"sub": clientID,
+		"aud": audience,
+		"jti": hex.EncodeToString(jti),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+	})
+}
+
+// signClaims returns a signed JWT with the given claims.
+func (s *clientAssertionSigner) signClaims(claims map[string]interface{}) (string, error) {
+	header := map[string]string{"alg": s.alg, "typ": "JWT"}
+	if s.kid != "" {
+		header["kid"] = s.kid
+	}
+	if s.x5t != "" {
+		header["x5t"] = s.x5t
+		header["x5t#S256"] = s.x5tS256
+	}
+
+	headerJson, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJson, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJson) + "." + base64.RawURLEncoding.EncodeToString(claimsJson)
+
+	digest := s.hash.New()
+	digest.Write([]byte(signingInput))
+	signature, err := s.signDigest(digest.Sum(nil))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (s *clientAssertionSigner) signDigest(digest []byte) ([]byte, error) {
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, key, s.hash, digest)
+	case *ecdsa.PrivateKey:
+		// JWS uses the fixed size concatenation of r and s instead of ASN.1
+		r, sig, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return nil, err
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		sig.FillBytes(signature[size:])
+		return signature, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", s.key)
+}
+
+type oauth2PrivateKeyJWT struct {
+	clientID string
+	tokenUrl string
+	scopes   []string
+	signer   *clientAssertionSigner
+	client   *http.Client
+}
+
+func (p *oauth2PrivateKeyJWT) Token() (*oauth2.Token, error) {
+	assertion, err := p.signer.sign(p.clientID, p.tokenUrl, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("client assertion could not be signed: %w", err)
+	}
+
+	config := clientcredentials.Config{
+		ClientID: p.clientID,
+		TokenURL: p.tokenUrl,
+		Scopes:   p.scopes,
+		EndpointParams: url.Values{
+			"client_assertion_type": {ClientAssertionTypeJWTBearer},
+			"client_assertion":      {assertion},
+		},
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+	return config.Token(httpClientContext(p.client))
+}
+
+// NewOauth2PrivateKeyJWT returns an authenticator using the client credentials flow with a client assertion
+// signed by privateKey (private_key_jwt, RFC 7523) instead of a client secret. certificate is optional and
+// adds the certificate thumbprint headers, which Entra requires.
+func NewOauth2PrivateKeyJWT(clientID, tokenUrl string, scopes []string, privateKey, certificate string, client *http.Client) (auth.Authenticator, error) {
+	signer, err := newClientAssertionSigner(privateKey, certificate)
+	if err != nil {
+		return nil, err
+	}
+	return newTokenSourceAuthenticator("oauth2_private_key_jwt", &oauth2PrivateKeyJWT{
+		clientID: clientID,
+		tokenUrl: tokenUrl,
+		scopes:   scopes,
+		signer:   signer,
+		client:   client,
+	}), nil
+}
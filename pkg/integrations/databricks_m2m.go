@@ -0,0 +1,47 @@
+package integrations
+
+import (
+	"github.com/databricks/databricks-sql-go/auth"
+	"github.com/databricks/databricks-sql-go/auth/oauth/m2m"
+	"golang.org/x/oauth2"
+	"net/http"
+	"sync"
+)
+
+// databricksM2M is the Databricks M2M OAuth flow of the driver, with the token endpoint discovery and token
+// requests sent through client.
+type databricksM2M struct {
+	clientID     string
+	clientSecret string
+	hostName     string
+	scopes       []string
+	client       *http.Client
+	tokenSource  oauth2.TokenSource
+	mx           sync.Mutex
+}
+
+func (m *databricksM2M) Token() (*oauth2.Token, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if m.tokenSource == nil {
+		config, err := m2m.GetConfig(httpClientContext(m.client), m.hostName, m.clientID, m.clientSecret, m.scopes)
+		if err != nil {
+			return nil, err
+		}
+		m.tokenSource = config.TokenSource(httpClientContext(m.client))
+	}
+	return m.tokenSource.Token()
+}
+
+// NewDatabricksM2M returns an authenticator using a Databricks OAuth secret of a service principal, like
+// m2m.NewAuthenticatorWithScopes but with the TLS and proxy settings of client.
+func NewDatabricksM2M(clientID, clientSecret, hostName string, scopes []string, client *http.Client) auth.Authenticator {
+	return newTokenSourceAuthenticator("m2m", &databricksM2M{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		hostName:     hostName,
+		scopes:       m2m.GetScopes(hostName, scopes),
+		client:       client,
+	})
+}
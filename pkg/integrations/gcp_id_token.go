@@ -0,0 +1,152 @@
+package integrations
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/databricks/databricks-sql-go/auth"
+	"golang.org/x/oauth2"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GrantTypeJWTBearer is the grant type of a JWT authorization grant (RFC 7523).
+const GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// gcpIDTokenLifetime is the validity of the assertion requesting an ID token, Google limits it to one hour.
+const gcpIDTokenLifetime = time.Hour
+
+// gcpServiceAccountKey is the JSON key file of a Google service account.
+type gcpServiceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// gcpIDToken creates Google OIDC ID tokens for the Databricks audience with a service account key.
+type gcpIDToken struct {
+	email    string
+	tokenUri string
+	audience string
+	signer   *clientAssertionSigner
+	client   *http.Client
+}
+
+func (g *gcpIDToken) Token() (*oauth2.Token, error) {
+	now := time.Now()
+	assertion, err := g.signer.signClaims(map[string]interface{}{
+		"iss":             g.email,
+		"sub":             g.email,
+		"aud":             g.tokenUri,
+		"iat":             now.Unix(),
+		"exp":             now.Add(gcpIDTokenLifetime).Unix(),
+		"target_audience": g.audience,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service account assertion could not be signed: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {GrantTypeJWTBearer},
+		"assertion":  {assertion},
+	}
+	resp, err := httpClientOrDefault(g.client).PostForm(g.tokenUri, form)
+	if err != nil {
+		return nil, fmt.Errorf("google ID token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("google ID token response could not be read: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp tokenErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("google ID token request failed with status %d: %s: %s", resp.StatusCode, errResp.Error, errResp.ErrorDescription)
+		}
+		return nil, fmt.Errorf("google ID token request failed with status %d", resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("google ID token response could not be parsed: %w", err)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, fmt.Errorf("google ID token response contains no ID token")
+	}
+	expiry, err := jwtExpiry(tokenResp.IDToken)
+	if err != nil {
+		return nil, fmt.Errorf("google ID token is invalid: %w", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: tokenResp.IDToken,
+		TokenType:   "Bearer",
+		Expiry:      expiry,
+	}, nil
+}
+
+// jwtExpiry returns the exp claim of a JWT, without verifying the signature.
+func jwtExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("JWT payload could not be decoded: %w", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("JWT payload could not be parsed: %w", err)
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("JWT has no exp claim")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// NewGCPIDToken returns an authenticator attaching Google OIDC ID tokens for audience, created with the
+// service account key JSON. Tokens are refreshed before they expire.
+func NewGCPIDToken(serviceAccountKey, audience string, client *http.Client) (auth.Authenticator, error) {
+	var key gcpServiceAccountKey
+	if err := json.Unmarshal([]byte(serviceAccountKey), &key); err != nil {
+		return nil, fmt.Errorf("service account key is not valid JSON: %w", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("service account key has type %q, expected service_account", key.Type)
+	}
+	if key.ClientEmail == "" {
+		return nil, fmt.Errorf("service account key is missing client_email")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	if audience == "" {
+		return nil, fmt.Errorf("google ID token audience is missing")
+	}
+
+	signer, err := newClientAssertionSigner(key.PrivateKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("service account private key is invalid: %w", err)
+	}
+	signer.kid = key.PrivateKeyID
+
+	return newTokenSourceAuthenticator("gcp_id_token", &gcpIDToken{
+		email:    key.ClientEmail,
+		tokenUri: key.TokenURI,
+		audience: audience,
+		signer:   signer,
+		client:   client,
+	}), nil
+}
@@ -0,0 +1,218 @@
+package integrations
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAudience = "https://example.gcp.databricks.com"
+
+// checkGoogleTokenRequest verifies the jwt-bearer assertion of a token request, signed with key.
+func checkGoogleTokenRequest(key *rsa.PrivateKey) func(r *http.Request) error {
+	return func(r *http.Request) error {
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		if r.PostForm.Get("grant_type") != GrantTypeJWTBearer {
+			return fmt.Errorf("expected grant type %s, got %q", GrantTypeJWTBearer, r.PostForm.Get("grant_type"))
+		}
+
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if len(parts) != 3 {
+			return fmt.Errorf("assertion is not a JWT: %q", r.PostForm.Get("assertion"))
+		}
+		var header map[string]string
+		if err := decodeSegment(parts[0], &header); err != nil {
+			return err
+		}
+		if header["alg"] != "RS256" || header["kid"] != "test-key-id" {
+			return fmt.Errorf("unexpected assertion header %v", header)
+		}
+		var claims map[string]interface{}
+		if err := decodeSegment(parts[1], &claims); err != nil {
+			return err
+		}
+		if claims["target_audience"] != testAudience {
+			return fmt.Errorf("expected target_audience %s, got %v", testAudience, claims["target_audience"])
+		}
+		if claims["iss"] != "grafana@project.iam.gserviceaccount.com" || claims["aud"] != "http://"+r.Host+r.URL.Path {
+			return fmt.Errorf("unexpected assertion claims %v", claims)
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("assertion signature is invalid: %w", err)
+		}
+		return nil
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// testIDToken returns an unsigned JWT with the given subject and expiry.
+func testIDToken(subject string, expiry time.Time) string {
+	payload := fmt.Sprintf(`{"sub":%q,"exp":%d}`, subject, expiry.Unix())
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+// newGoogleTokenEndpoint returns a token endpoint stand-in and the service account key using it.
+func newGoogleTokenEndpoint(t *testing.T, respond func(w http.ResponseWriter, call int32)) (*tokenEndpoint, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := newTokenEndpoint(t, checkGoogleTokenRequest(key), respond)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceAccountKey, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "grafana@project.iam.gserviceaccount.com",
+		"private_key_id": "test-key-id",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      endpoint.srv.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return endpoint, string(serviceAccountKey)
+}
+
+func TestGCPIDToken(t *testing.T) {
+	endpoint, key := newGoogleTokenEndpoint(t, func(w http.ResponseWriter, call int32) {
+		_, _ = fmt.Fprintf(w, `{"id_token":%q}`, testIDToken(fmt.Sprintf("token-%d", call), time.Now().Add(time.Hour)))
+	})
+	authenticator, err := NewGCPIDToken(key, testAudience, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := authorization(t, authenticator.Authenticate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first, "Bearer eyJ") {
+		t.Fatalf("unexpected authorization header %q", first)
+	}
+	second, err := authorization(t, authenticator.Authenticate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || endpoint.calls.Load() != 1 {
+		t.Fatalf("expected the ID token to be reused, got %d requests", endpoint.calls.Load())
+	}
+}
+
+func TestGCPIDTokenRefreshesBeforeExpiry(t *testing.T) {
+	endpoint, key := newGoogleTokenEndpoint(t, func(w http.ResponseWriter, call int32) {
+		// Expires within tokenExpiryDelta, so it is never reused
+		_, _ = fmt.Fprintf(w, `{"id_token":%q}`, testIDToken(fmt.Sprintf("token-%d", call), time.Now().Add(tokenExpiryDelta-time.Minute)))
+	})
+	authenticator, err := NewGCPIDToken(key, testAudience, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := authorization(t, authenticator.Authenticate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := authorization(t, authenticator.Authenticate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || endpoint.calls.Load() != 2 {
+		t.Fatalf("expected a refreshed ID token, got %d requests", endpoint.calls.Load())
+	}
+}
+
+func TestGCPIDTokenResponseErrors(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		body   string
+		want   []string
+	}{
+		"error response": {http.StatusBadRequest, `{"error":"invalid_grant","error_description":"Invalid JWT Signature."}`, []string{"400", "invalid_grant", "Invalid JWT Signature."}},
+		"no id_token":    {http.StatusOK, `{"access_token":"ya29.token"}`, []string{"no ID token"}},
+		"no exp claim":   {http.StatusOK, `{"id_token":"a.e30.b"}`, []string{"no exp claim"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, key := newGoogleTokenEndpoint(t, func(w http.ResponseWriter, call int32) {
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, tt.body)
+			})
+			authenticator, err := NewGCPIDToken(key, testAudience, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = authorization(t, authenticator.Authenticate)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(err.Error(), part) {
+					t.Errorf("expected error to contain %q, got %q", part, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGCPIDTokenInvalidKey(t *testing.T) {
+	_, valid := newGoogleTokenEndpoint(t, func(w http.ResponseWriter, call int32) {})
+	withField := func(field string, value interface{}) string {
+		var key map[string]interface{}
+		if err := json.Unmarshal([]byte(valid), &key); err != nil {
+			t.Fatal(err)
+		}
+		key[field] = value
+		data, err := json.Marshal(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := map[string]struct {
+		key      string
+		audience string
+		want     string
+	}{
+		"not json":             {"service_account", testAudience, "not valid JSON"},
+		"wrong type":           {withField("type", "authorized_user"), testAudience, "expected service_account"},
+		"missing client_email": {withField("client_email", ""), testAudience, "client_email"},
+		"invalid private key":  {withField("private_key", "not a key"), testAudience, "private key"},
+		"missing audience":     {valid, "", "audience"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewGCPIDToken(tt.key, tt.audience, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
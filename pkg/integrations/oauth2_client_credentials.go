@@ -1,20 +1,41 @@
 package integrations
 
 import (
-	"context"
+	"fmt"
 	"github.com/databricks/databricks-sql-go/auth"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 	"net/http"
+	"net/url"
 	"sync"
 )
 
+// Client authentication styles at the token endpoint
+const (
+	AuthStyleAuto   = ""
+	AuthStyleHeader = "header"
+	AuthStyleBody   = "body"
+)
+
+// Oauth2ClientCredentialsOptions are optional settings of the client credentials flow.
+type Oauth2ClientCredentialsOptions struct {
+	// Audience and Resource are sent as endpoint parameters, as required by some identity providers
+	Audience string
+	Resource string
+	// AuthStyle sends the client credentials as basic auth header or in the request body, by default
+	// both are tried
+	AuthStyle string
+	// HTTPClient sends the token requests, with the TLS and proxy settings of the datasource
+	HTTPClient *http.Client
+}
+
 type oauth2ClientCredentials struct {
 	clientID     string
 	clientSecret string
 	tokenUrl     string
 	scopes       []string
+	options      Oauth2ClientCredentialsOptions
 	tokenSource  oauth2.TokenSource
 	mx           sync.Mutex
 }
@@ -25,17 +46,20 @@ func (c *oauth2ClientCredentials) Authenticate(r *http.Request) error {
 
 	if c.tokenSource == nil {
 		config := clientcredentials.Config{
-			ClientID:     c.clientID,
-			ClientSecret: c.clientSecret,
-			TokenURL:     c.tokenUrl,
-			Scopes:       c.scopes,
+			ClientID:       c.clientID,
+			ClientSecret:   c.clientSecret,
+			TokenURL:       c.tokenUrl,
+			Scopes:         c.scopes,
+			EndpointParams: c.endpointParams(),
+			AuthStyle:      authStyle(c.options.AuthStyle),
 		}
-		c.tokenSource = config.TokenSource(context.Background())
+		c.tokenSource = config.TokenSource(httpClientContext(c.options.HTTPClient))
 	}
 
 	token, err := c.tokenSource.Token()
 
 	if err != nil {
+		err = describeTokenError(err)
 		log.DefaultLogger.Error("token fetching failed", "err", err)
 		return err
 	}
@@ -47,12 +71,49 @@ func (c *oauth2ClientCredentials) Authenticate(r *http.Request) error {
 
 }
 
+func (c *oauth2ClientCredentials) endpointParams() url.Values {
+	params := url.Values{}
+	if c.options.Audience != "" {
+		params.Set("audience", c.options.Audience)
+	}
+	if c.options.Resource != "" {
+		params.Set("resource", c.options.Resource)
+	}
+	return params
+}
+
+func authStyle(style string) oauth2.AuthStyle {
+	switch style {
+	case AuthStyleHeader:
+		return oauth2.AuthStyleInHeader
+	case AuthStyleBody:
+		return oauth2.AuthStyleInParams
+	}
+	return oauth2.AuthStyleAutoDetect
+}
+
+// ValidateAuthStyle checks that style is a supported client authentication style.
+func ValidateAuthStyle(style string) error {
+	switch style {
+	case AuthStyleAuto, AuthStyleHeader, AuthStyleBody:
+		return nil
+	}
+	return fmt.Errorf("invalid OAuth auth style: %s, must be %s or %s", style, AuthStyleHeader, AuthStyleBody)
+}
+
 func NewOauth2ClientCredentials(clientID, clientSecret, tokenUrl string, scopes []string) auth.Authenticator {
+	return NewOauth2ClientCredentialsWithOptions(clientID, clientSecret, tokenUrl, scopes, Oauth2ClientCredentialsOptions{})
+}
+
+// NewOauth2ClientCredentialsWithOptions returns a client credentials authenticator with audience, resource
+// and auth style options.
+func NewOauth2ClientCredentialsWithOptions(clientID, clientSecret, tokenUrl string, scopes []string, options Oauth2ClientCredentialsOptions) auth.Authenticator {
 	return &oauth2ClientCredentials{
 		clientID:     clientID,
 		clientSecret: clientSecret,
 		tokenUrl:     tokenUrl,
 		scopes:       scopes,
+		options:      options,
 		tokenSource:  nil,
 		mx:           sync.Mutex{},
 	}
@@ -0,0 +1,209 @@
+package integrations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token types and grant type of the OAuth 2.0 token exchange (RFC 8693)
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDToken       = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// OAuth2TokenExchangeAuthenticator exchanges the token of the signed-in user, forwarded by Grafana, for a token
+// with the Databricks audience (RFC 8693). Exchanged tokens are cached per subject token until shortly
+// before they expire.
+type OAuth2TokenExchangeAuthenticator struct {
+	tokenUrl         string
+	clientID         string
+	clientSecret     string
+	audience         string
+	scopes           []string
+	subjectTokenType string
+	client           *http.Client
+	mu               sync.Mutex
+	cache            map[string]*oauth2.Token
+	// exchanges deduplicates concurrent exchanges of the same subject token
+	exchanges singleflight.Group
+}
+
+type tokenExchangeResponse struct {
+	AccessToken     string      `json:"access_token"`
+	IssuedTokenType string      `json:"issued_token_type"`
+	TokenType       string      `json:"token_type"`
+	ExpiresIn       json.Number `json:"expires_in"`
+}
+
+// NewOAuth2TokenExchangeAuthenticator returns a token exchange authenticator for the token endpoint tokenUrl.
+// clientID and clientSecret are optional and authenticate the plugin at the token endpoint. subjectTokenType
+// defaults to an access token, with an ID token type the forwarded ID token of the user is exchanged.
+func NewOAuth2TokenExchangeAuthenticator(tokenUrl, clientID, clientSecret, audience string, scopes []string, subjectTokenType string, client *http.Client) *OAuth2TokenExchangeAuthenticator {
+	if subjectTokenType == "" {
+		subjectTokenType = TokenTypeAccessToken
+	}
+	return &OAuth2TokenExchangeAuthenticator{
+		tokenUrl:         tokenUrl,
+		clientID:         clientID,
+		clientSecret:     clientSecret,
+		audience:         audience,
+		scopes:           scopes,
+		subjectTokenType: subjectTokenType,
+		client:           client,
+		cache:            map[string]*oauth2.Token{},
+	}
+}
+
+func (a *OAuth2TokenExchangeAuthenticator) Authenticate(r *http.Request) error {
+	contextKey := "pass_through_oauth_token"
+	if a.subjectTokenType == TokenTypeIDToken {
+		contextKey = "pass_through_id_token"
+	}
+	// There is deliberately no fallback to a stored token, requests without the token of a signed-in user
+	// (i.e. alerting or health checks) must not act with the identity of another user
+	subjectToken, ok := r.Context().Value(contextKey).(string)
+	if !ok || subjectToken == "" {
+		return &TokenError{Err: fmt.Errorf("OAuth token exchange subject token is missing, the request has no signed-in user")}
+	}
+	subjectToken = strings.TrimSpace(strings.TrimPrefix(subjectToken, "Bearer "))
+
+	token, err := a.token(subjectToken)
+	if err != nil {
+		log.DefaultLogger.Error("token exchange failed", "err", err)
+		return &TokenError{Err: err}
+	}
+	token.SetAuthHeader(r)
+	return nil
+}
+
+// token returns the cached token of the subject token or exchanges it. The lock is not held during the
+// exchange, so a slow token endpoint only delays requests of the same subject token.
+func (a *OAuth2TokenExchangeAuthenticator) token(subjectToken string) (*oauth2.Token, error) {
+	sum := sha256.Sum256([]byte(subjectToken))
+	key := hex.EncodeToString(sum[:])
+
+	if token, ok := a.cached(key); ok {
+		return token, nil
+	}
+
+	token, err, _ := a.exchanges.Do(key, func() (interface{}, error) {
+		if token, ok := a.cached(key); ok {
+			return token, nil
+		}
+		token, err := a.exchange(subjectToken)
+		if err != nil {
+			return nil, err
+		}
+		log.DefaultLogger.Debug("token exchanged successfully")
+		a.store(key, token)
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token.(*oauth2.Token), nil
+}
+
+// cached returns the cached token of key, if it doesn't expire soon.
+func (a *OAuth2TokenExchangeAuthenticator) cached(key string) (*oauth2.Token, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	token, ok := a.cache[key]
+	if !ok || time.Until(token.Expiry) <= tokenExpiryDelta {
+		return nil, false
+	}
+	return token, true
+}
+
+// store caches the token of key and removes expired tokens, so tokens of users which are gone don't pile up.
+func (a *OAuth2TokenExchangeAuthenticator) store(key string, token *oauth2.Token) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, cached := range a.cache {
+		if time.Until(cached.Expiry) <= tokenExpiryDelta {
+			delete(a.cache, k)
+		}
+	}
+	if !token.Expiry.IsZero() {
+		a.cache[key] = token
+	}
+}
+
+func (a *OAuth2TokenExchangeAuthenticator) exchange(subjectToken string) (*oauth2.Token, error) {
+	form := url.Values{
+		"grant_type":           {GrantTypeTokenExchange},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {a.subjectTokenType},
+		"requested_token_type": {TokenTypeAccessToken},
+	}
+	if a.audience != "" {
+		form.Set("audience", a.audience)
+	}
+	if len(a.scopes) > 0 {
+		form.Set("scope", strings.Join(a.scopes, " "))
+	}
+	if a.clientID != "" && a.clientSecret == "" {
+		// Public client
+		form.Set("client_id", a.clientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if a.clientID != "" && a.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(a.clientID), url.QueryEscape(a.clientSecret))
+	}
+
+	resp, err := httpClientOrDefault(a.client).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("token exchange response could not be read: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp tokenErrorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("token exchange failed with status %d: %s: %s", resp.StatusCode, errResp.Error, errResp.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token exchange failed with status %d", resp.StatusCode)
+	}
+
+	var tokenResp tokenExchangeResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("token exchange response could not be parsed: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange response contains no access token")
+	}
+
+	token := &oauth2.Token{AccessToken: tokenResp.AccessToken, TokenType: tokenResp.TokenType}
+	if strings.EqualFold(token.TokenType, "N_A") {
+		// Token type of tokens which are no access tokens (RFC 8693 section 2.2.1)
+		token.TokenType = "Bearer"
+	}
+	if expiresIn, err := strconv.ParseInt(tokenResp.ExpiresIn.String(), 10, 64); err == nil && expiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token, nil
+}
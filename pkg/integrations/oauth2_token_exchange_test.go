@@ -0,0 +1,38 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestOAuth2TokenExchangeWithoutSubjectToken(t *testing.T) {
+	endpoint := newTokenEndpoint(t, func(r *http.Request) error {
+		return r.ParseForm()
+	}, func(w http.ResponseWriter, call int32) {
+		_, _ = fmt.Fprintf(w, `{"access_token":"exchanged-%d","token_type":"Bearer","expires_in":3600}`, call)
+	})
+	authenticator := NewOAuth2TokenExchangeAuthenticator(endpoint.srv.URL, "", "", "", nil, "", endpoint.srv.Client())
+
+	// A request of a signed-in user is exchanged
+	req, err := http.NewRequestWithContext(context.WithValue(context.Background(), "pass_through_oauth_token", "Bearer alice"), http.MethodGet, "https://example.cloud.databricks.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := authenticator.Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+	if header := req.Header.Get("Authorization"); header != "Bearer exchanged-1" {
+		t.Fatalf("unexpected authorization header %q", header)
+	}
+
+	// A background request afterwards must not reuse the token of the last user
+	header, err := authorization(t, authenticator.Authenticate)
+	if err == nil || header != "" {
+		t.Fatalf("expected an error without subject token, got %q, %v", header, err)
+	}
+	if calls := endpoint.calls.Load(); calls != 1 {
+		t.Fatalf("expected a single token exchange, got %d", calls)
+	}
+}
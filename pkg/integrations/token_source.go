@@ -0,0 +1,115 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/databricks/databricks-sql-go/auth"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"golang.org/x/oauth2"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// tokenExpiryDelta is the time before expiry at which a cached token is refreshed.
+const tokenExpiryDelta = 5 * time.Minute
+
+// tokenErrorResponse is the error response of an OAuth token endpoint (RFC 6749 section 5.2).
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// TokenError is returned by authenticators which could not obtain a token. It keeps the cause, so a failing
+// token endpoint can be told apart from a failing Databricks API.
+type TokenError struct {
+	Err error
+}
+
+func (e *TokenError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// tokenSourceAuthenticator sets the token of a token source as Authorization header of every request.
+type tokenSourceAuthenticator struct {
+	method      string
+	tokenSource oauth2.TokenSource
+}
+
+// newTokenSourceAuthenticator returns an authenticator caching the tokens of tokenSource until shortly before they expire.
+func newTokenSourceAuthenticator(method string, tokenSource oauth2.TokenSource) auth.Authenticator {
+	return &tokenSourceAuthenticator{
+		method:      method,
+		tokenSource: oauth2.ReuseTokenSourceWithExpiry(nil, tokenSource, tokenExpiryDelta),
+	}
+}
+
+func (a *tokenSourceAuthenticator) Authenticate(r *http.Request) error {
+	token, err := a.tokenSource.Token()
+	if err != nil {
+		err = describeTokenError(err)
+		log.DefaultLogger.Error("token fetching failed", "method", a.method, "err", err)
+		return err
+	}
+
+	log.DefaultLogger.Debug("token fetched successfully", "method", a.method)
+	token.SetAuthHeader(r)
+	return nil
+}
+
+// httpClientContext returns a context for token requests using client. Without a client the default HTTP
+// client is used.
+func httpClientContext(client *http.Client) context.Context {
+	if client == nil {
+		return context.Background()
+	}
+	return context.WithValue(context.Background(), oauth2.HTTPClient, client)
+}
+
+func httpClientOrDefault(client *http.Client) *http.Client {
+	if client == nil {
+		return http.DefaultClient
+	}
+	return client
+}
+
+// describeTokenError returns the error of a failed token request as TokenError, with the error and
+// error_description fields of the token endpoint response instead of the raw response body.
+func describeTokenError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return &TokenError{Err: err}
+	}
+	status := 0
+	if retrieveErr.Response != nil {
+		status = retrieveErr.Response.StatusCode
+	}
+	if retrieveErr.ErrorCode == "" {
+		return &TokenError{Err: fmt.Errorf("token endpoint request failed with status %d", status)}
+	}
+	if retrieveErr.ErrorDescription == "" {
+		return &TokenError{Err: fmt.Errorf("token endpoint request failed with status %d: %s", status, retrieveErr.ErrorCode)}
+	}
+	return &TokenError{Err: fmt.Errorf("token endpoint request failed with status %d: %s: %s", status, retrieveErr.ErrorCode, retrieveErr.ErrorDescription)}
+}
+
+// ParseScopes parses a list of OAuth scopes separated by commas or spaces. Empty entries are ignored and
+// every scope must only contain the characters allowed by RFC 6749 section 3.3.
+func ParseScopes(raw string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		for _, c := range scope {
+			if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+				return nil, fmt.Errorf("invalid OAuth scope %q, scopes must not contain quotes, backslashes or non-ASCII characters", scope)
+			}
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
@@ -0,0 +1,43 @@
+package integrations
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// tokenEndpoint is a local stand-in of a token endpoint counting its requests. check verifies a request,
+// an unexpected request fails the test and is answered with HTTP 400.
+type tokenEndpoint struct {
+	calls atomic.Int32
+	srv   *httptest.Server
+}
+
+func newTokenEndpoint(t *testing.T, check func(r *http.Request) error, respond func(w http.ResponseWriter, call int32)) *tokenEndpoint {
+	endpoint := &tokenEndpoint{}
+	endpoint.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := endpoint.calls.Add(1)
+		if check != nil {
+			if err := check(r); err != nil {
+				t.Errorf("unexpected token request: %s", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		respond(w, call)
+	}))
+	t.Cleanup(endpoint.srv.Close)
+	return endpoint
+}
+
+// authorization authenticates a request and returns its authorization header.
+func authorization(t *testing.T, authenticate func(r *http.Request) error) (string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "https://example.cloud.databricks.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = authenticate(req)
+	return req.Header.Get("Authorization"), err
+}
@@ -0,0 +1,99 @@
+package integrations
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/databricks/databricks-sql-go/auth"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ClientAssertionTypeJWTBearer is the client assertion type of a signed JWT (RFC 7523).
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// WorkloadIdentityTokenDir is the only directory a token file can be configured in, so the datasource
+// settings can't send arbitrary files of the Grafana host to a token endpoint.
+const WorkloadIdentityTokenDir = "/var/run/secrets/"
+
+// ValidateTokenFile returns an error if path is no absolute path within WorkloadIdentityTokenDir.
+func ValidateTokenFile(path string) error {
+	if !filepath.IsAbs(path) || !strings.HasPrefix(filepath.Clean(path), WorkloadIdentityTokenDir) {
+		return fmt.Errorf("invalid token file %q, the token file must be located in %s", path, WorkloadIdentityTokenDir)
+	}
+	return nil
+}
+
+// isCompactJWT returns true if token is a JWT in compact serialization with a JSON header and payload.
+func isCompactJWT(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[2] == "" {
+		return false
+	}
+	for _, part := range parts[:2] {
+		data, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil || !json.Valid(data) {
+			return false
+		}
+	}
+	return true
+}
+
+// workloadIdentity exchanges a projected service account token for an access token. The token file is
+// rotated by Kubernetes and read again on every token request, so no long-lived secret is needed.
+type workloadIdentity struct {
+	tokenFile string
+	exchange  func(assertion string) (*oauth2.Token, error)
+}
+
+func (w *workloadIdentity) Token() (*oauth2.Token, error) {
+	assertion, err := os.ReadFile(w.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("service account token could not be read: %w", err)
+	}
+	token := strings.TrimSpace(string(assertion))
+	if token == "" {
+		return nil, fmt.Errorf("service account token file %s is empty", w.tokenFile)
+	}
+	if !isCompactJWT(token) {
+		return nil, fmt.Errorf("service account token file %s does not contain a JWT", w.tokenFile)
+	}
+	return w.exchange(token)
+}
+
+// NewWorkloadIdentity returns an authenticator using the projected service account token in tokenFile as
+// client assertion (federated credential) for the token endpoint tokenUrl, i.e. Entra.
+func NewWorkloadIdentity(clientID, tokenFile, tokenUrl string, scopes []string, client *http.Client) auth.Authenticator {
+	return newTokenSourceAuthenticator("workload_identity", &workloadIdentity{
+		tokenFile: tokenFile,
+		exchange: func(assertion string) (*oauth2.Token, error) {
+			config := clientcredentials.Config{
+				ClientID: clientID,
+				TokenURL: tokenUrl,
+				Scopes:   scopes,
+				EndpointParams: url.Values{
+					"client_assertion_type": {ClientAssertionTypeJWTBearer},
+					"client_assertion":      {assertion},
+				},
+				AuthStyle: oauth2.AuthStyleInParams,
+			}
+			return config.Token(httpClientContext(client))
+		},
+	})
+}
+
+// NewDatabricksWorkloadIdentity returns an authenticator exchanging the projected service account token in
+// tokenFile as JWT subject token (RFC 8693) at the OIDC token endpoint tokenUrl of the Databricks workspace
+// (workload identity federation). clientID is the service principal of the federation policy.
+func NewDatabricksWorkloadIdentity(clientID, tokenFile, tokenUrl string, scopes []string, client *http.Client) auth.Authenticator {
+	exchange := NewOAuth2TokenExchangeAuthenticator(tokenUrl, clientID, "", "", scopes, TokenTypeJWT, client)
+	return newTokenSourceAuthenticator("workload_identity", &workloadIdentity{
+		tokenFile: tokenFile,
+		exchange:  exchange.exchange,
+	})
+}
@@ -0,0 +1,85 @@
+package integrations
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTokenFile(t *testing.T) {
+	tests := []struct {
+		path  string
+		valid bool
+	}{
+		{"/var/run/secrets/azure/tokens/azure-identity-token", true},
+		{"/var/run/secrets/kubernetes.io/serviceaccount/token", true},
+		{"/etc/grafana/grafana.ini", false},
+		{"/var/lib/grafana/grafana.db", false},
+		{"/var/run/secrets/../../../etc/grafana/grafana.ini", false},
+		{"/var/run/secrets-other/token", false},
+		{"var/run/secrets/token", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if err := ValidateTokenFile(tt.path); (err == nil) != tt.valid {
+				t.Errorf("expected valid=%t, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestWorkloadIdentityTokenFileContent(t *testing.T) {
+	jwt := testIDToken("system:serviceaccount:grafana:grafana", time.Now().Add(time.Hour))
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"jwt", jwt + "\n", ""},
+		{"empty", "\n", "is empty"},
+		{"ini file", "[security]\nsecret_key = SW2YcwTIb9zpOOhoPsMm\n", "does not contain a JWT"},
+		{"no json", "a.b.c", "does not contain a JWT"},
+		{"unsigned", strings.TrimSuffix(jwt, "c2lnbmF0dXJl"), "does not contain a JWT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := newTokenEndpoint(t, func(r *http.Request) error {
+				if err := r.ParseForm(); err != nil {
+					return err
+				}
+				if r.PostForm.Get("client_assertion") != jwt {
+					return fmt.Errorf("unexpected client assertion %q", r.PostForm.Get("client_assertion"))
+				}
+				return nil
+			}, func(w http.ResponseWriter, call int32) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = fmt.Fprint(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+			})
+
+			tokenFile := filepath.Join(t.TempDir(), "token")
+			if err := os.WriteFile(tokenFile, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			authenticator := NewWorkloadIdentity("client-id", tokenFile, endpoint.srv.URL, []string{AzureDatabricksScope()}, endpoint.srv.Client())
+
+			header, err := authorization(t, authenticator.Authenticate)
+			if tt.want == "" {
+				if err != nil || header != "Bearer token" {
+					t.Fatalf("expected the token, got %q, %v", header, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+			if calls := endpoint.calls.Load(); calls != 0 {
+				t.Fatalf("expected no token request, got %d", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type admissionPriority int
+
+const (
+	admissionPriorityInteractive admissionPriority = iota
+	// admissionPriorityAlert is used for alert evaluations, which are admitted before interactive queries
+	admissionPriorityAlert
+)
+
+// admissionWaiter is a request waiting in the queue, ready is closed once a slot was handed over to it.
+type admissionWaiter struct {
+	ready chan struct{}
+}
+
+// admissionController limits the number of concurrent statements of a datasource. Requests exceeding
+// the limit wait in a bounded queue per priority, alert evaluations are admitted before interactive queries.
+type admissionController struct {
+	mu            sync.Mutex
+	maxConcurrent int
+	maxQueued     int
+	waitTimeout   time.Duration
+	running       int
+	// queues holds the waiting requests per priority in FIFO order
+	queues map[admissionPriority][]*admissionWaiter
+}
+
+// newAdmissionController returns an admission controller, a maxConcurrent of 0 disables the limit.
+func newAdmissionController(maxConcurrent int, maxQueued int, waitTimeout time.Duration) *admissionController {
+	return &admissionController{
+		maxConcurrent: maxConcurrent,
+		maxQueued:     maxQueued,
+		waitTimeout:   waitTimeout,
+		queues:        map[admissionPriority][]*admissionWaiter{},
+	}
+}
+
+func admissionPriorityFromContext(ctx context.Context) admissionPriority {
+	if requestInfoFromContext(ctx).FromAlert {
+		return admissionPriorityAlert
+	}
+	return admissionPriorityInteractive
+}
+
+func errDatasourceBusy(reason string) error {
+	return newQueryError(errorCategoryBusy, fmt.Errorf("too many concurrent queries, %s", reason))
+}
+
+// acquire waits for a free slot and returns a function releasing it. If the queue is full or no slot becomes
+// free within the wait timeout, a datasource busy error is returned. Alert evaluations have their own queue
+// of the same size, so interactive queries can't starve them. A wait timeout of 0 disables waiting.
+func (c *admissionController) acquire(ctx context.Context) (func(), error) {
+	if c == nil || c.maxConcurrent <= 0 {
+		return func() {}, nil
+	}
+
+	c.mu.Lock()
+	if c.running < c.maxConcurrent {
+		c.running++
+		c.mu.Unlock()
+		return c.release, nil
+	}
+	if c.waitTimeout <= 0 {
+		c.mu.Unlock()
+		return nil, errDatasourceBusy("no query slot is free and queueing is disabled")
+	}
+	priority := admissionPriorityFromContext(ctx)
+	if len(c.queues[priority]) >= c.maxQueued {
+		c.mu.Unlock()
+		return nil, errDatasourceBusy(fmt.Sprintf("the queue is full (%d queued)", c.maxQueued))
+	}
+	waiter := &admissionWaiter{ready: make(chan struct{})}
+	c.queues[priority] = append(c.queues[priority], waiter)
+	c.mu.Unlock()
+
+	timer := time.NewTimer(c.waitTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-waiter.ready:
+		return c.release, nil
+	case <-timer.C:
+		err = errDatasourceBusy(fmt.Sprintf("no query slot became free within %s", c.waitTimeout))
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.remove(priority, waiter) {
+		// The slot was handed over while giving up, pass it on
+		c.releaseLocked()
+	}
+	return nil, err
+}
+
+func (c *admissionController) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.releaseLocked()
+}
+
+// releaseLocked hands the slot over to the next waiting request, alert evaluations first.
+func (c *admissionController) releaseLocked() {
+	for _, priority := range []admissionPriority{admissionPriorityAlert, admissionPriorityInteractive} {
+		if queue := c.queues[priority]; len(queue) > 0 {
+			c.queues[priority] = queue[1:]
+			close(queue[0].ready)
+			return
+		}
+	}
+	c.running--
+}
+
+func (c *admissionController) queued() int {
+	queued := 0
+	for _, queue := range c.queues {
+		queued += len(queue)
+	}
+	return queued
+}
+
+// remove removes a waiter from its queue and returns false if it isn't queued anymore.
+func (c *admissionController) remove(priority admissionPriority, waiter *admissionWaiter) bool {
+	queue := c.queues[priority]
+	for i, w := range queue {
+		if w == waiter {
+			c.queues[priority] = append(queue[:i:i], queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// stats returns the number of running and queued requests.
+func (c *admissionController) stats() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running, c.queued()
+}
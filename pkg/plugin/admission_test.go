@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdmissionAlertQueue(t *testing.T) {
+	c := newAdmissionController(1, 1, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	alertCtx := withRequestInfo(ctx, requestInfo{FromAlert: true})
+
+	release, err := c.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Fill the queue of both priorities, the acquisitions give up once ctx is canceled
+	waiting := make(chan error, 2)
+	for _, ctx := range []context.Context{ctx, alertCtx} {
+		go func() {
+			_, err := c.acquire(ctx)
+			waiting <- err
+		}()
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if _, queued := c.stats(); queued == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected an interactive query and an alert to be queued")
+		}
+	}
+
+	if _, err := c.acquire(ctx); classifyError(err) != errorCategoryBusy {
+		t.Errorf("expected an interactive query to be rejected by the full queue, got %v", err)
+	}
+	if _, err := c.acquire(alertCtx); classifyError(err) != errorCategoryBusy {
+		t.Errorf("expected an alert to be rejected by the full alert queue, got %v", err)
+	}
+
+	cancel()
+	for range 2 {
+		<-waiting
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerFromAlert    = "FromAlert"
+	headerDashboardUID = "X-Dashboard-Uid"
+	headerPanelID      = "X-Panel-Id"
+)
+
+// requestInfo describes where a query request originates from. It is used to attribute queries
+// in the Databricks query history.
+type requestInfo struct {
+	UserLogin    string
+	OrgID        int64
+	DashboardUID string
+	PanelID      string
+	FromAlert    bool
+}
+
+type requestInfoKey struct{}
+
+// requestHeader returns a header of a request sent by Grafana. Grafana forwards some headers
+// prefixed with "http_", others are set as is.
+func requestHeader(headers map[string]string, key string) string {
+	canonicalKey := textproto.CanonicalMIMEHeaderKey(key)
+	for k, v := range headers {
+		if textproto.CanonicalMIMEHeaderKey(strings.TrimPrefix(k, "http_")) == canonicalKey {
+			return v
+		}
+	}
+	return ""
+}
+
+func newRequestInfo(pCtx backend.PluginContext, headers map[string]string) requestInfo {
+	info := requestInfo{
+		OrgID:        pCtx.OrgID,
+		DashboardUID: requestHeader(headers, headerDashboardUID),
+		PanelID:      requestHeader(headers, headerPanelID),
+	}
+	if pCtx.User != nil {
+		info.UserLogin = pCtx.User.Login
+	}
+	info.FromAlert, _ = strconv.ParseBool(requestHeader(headers, headerFromAlert))
+	return info
+}
+
+func withRequestInfo(ctx context.Context, info requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func requestInfoFromContext(ctx context.Context) requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(requestInfo)
+	return info
+}
+
+// attributes returns the attribution key value pairs, empty values are omitted.
+func (i requestInfo) attributes() [][2]string {
+	attributes := [][2]string{
+		{"grafana_user", i.UserLogin},
+		{"grafana_org", strconv.FormatInt(i.OrgID, 10)},
+		{"grafana_dashboard", i.DashboardUID},
+		{"grafana_panel", i.PanelID},
+		{"grafana_alert", strconv.FormatBool(i.FromAlert)},
+	}
+	result := make([][2]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		if attribute[1] != "" {
+			result = append(result, attribute)
+		}
+	}
+	return result
+}
+
+// sanitizeAttribute keeps only letters, digits and "_.@-", so a value can neither break out of a SQL
+// comment or string literal nor add entries to the tag list.
+func sanitizeAttribute(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '_', r == '.', r == '@', r == '-':
+			return r
+		}
+		return -1
+	}, value)
+}
+
+// sqlComment returns a SQL comment identifying the origin of a query, e.g.
+// "/* grafana_user=alice grafana_org=1 grafana_dashboard=abc grafana_panel=2 grafana_alert=false */".
+func (i requestInfo) sqlComment() string {
+	parts := make([]string, 0, 5)
+	for _, attribute := range i.attributes() {
+		parts = append(parts, fmt.Sprintf("%s=%s", attribute[0], sanitizeAttribute(attribute[1])))
+	}
+	return fmt.Sprintf("/* %s */\n", strings.Join(parts, " "))
+}
+
+// queryTags returns the attribution as Databricks query tags ("key:value,key:value").
+func (i requestInfo) queryTags() string {
+	parts := make([]string, 0, 5)
+	for _, attribute := range i.attributes() {
+		parts = append(parts, fmt.Sprintf("%s:%s", attribute[0], sanitizeAttribute(attribute[1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+// applyAttribution adds the attribution comment to all statements of the session and sets the query tags.
+// Setting the query tags is best effort, if the warehouse doesn't support them they are not set again.
+func (s *querySession) applyAttribution(ctx context.Context, info requestInfo) {
+	s.setComment(info.sqlComment())
+	if s.d.queryTagsUnsupported.Load() {
+		return
+	}
+	// Query tags configured as session parameter of the datasource are kept and restored afterwards
+	configuredTags, _ := s.d.sessionParameter("QUERY_TAGS")
+	configuredTags = strings.ReplaceAll(configuredTags, "'", "")
+	tags := info.queryTags()
+	if configuredTags != "" {
+		tags = configuredTags + "," + tags
+	}
+	err := s.set(ctx,
+		fmt.Sprintf("SET QUERY_TAGS = '%s'", tags),
+		fmt.Sprintf("SET QUERY_TAGS = '%s'", configuredTags),
+	)
+	if err != nil {
+		loggerFromContext(ctx).Info("Query tags could not be set, only the SQL comment is used for attribution", "err", err)
+		if classifyError(err) == errorCategorySyntax {
+			s.d.queryTagsUnsupported.Store(true)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"sync"
+	"time"
+)
+
+type circuitState string
+
+const (
+	circuitStateClosed   circuitState = "closed"
+	circuitStateOpen     circuitState = "open"
+	circuitStateHalfOpen circuitState = "half_open"
+)
+
+// circuitBreaker stops sending queries to an unavailable warehouse. After threshold consecutive connectivity
+// failures the circuit opens and all queries fail fast instead of waiting through the retries of the driver.
+// Once openTimeout passed, a single probe query is let through (half-open), which closes the circuit again
+// if it succeeds.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	state       circuitState
+	failures    int
+	lastErr     error
+	openedAt    time.Time
+	probeAt     time.Time
+}
+
+type circuitBreakerBypassKey struct{}
+
+// newCircuitBreaker returns a circuit breaker, a threshold of 0 disables it.
+func newCircuitBreaker(threshold int, openTimeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		state:       circuitStateClosed,
+	}
+}
+
+// withoutCircuitBreaker lets statements of ctx pass an open circuit, used by the health check which
+// should always test the connection.
+func withoutCircuitBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, circuitBreakerBypassKey{}, true)
+}
+
+// isConnectivityFailure returns true for errors which indicate the warehouse can't be reached. An expired
+// session is routine and refreshed, it neither counts towards the circuit breaker nor triggers a failover.
+func isConnectivityFailure(err error) bool {
+	if err == nil || isInvalidSession(err) {
+		return false
+	}
+	return errors.Is(err, driver.ErrBadConn) || classifyError(err) == errorCategoryWarehouseUnavailable
+}
+
+// allow returns an error if the circuit is open. In half-open state one probe is allowed per openTimeout.
+func (b *circuitBreaker) allow(ctx context.Context) error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+	if bypass, _ := ctx.Value(circuitBreakerBypassKey{}).(bool); bypass {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitStateOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return b.openError()
+		}
+		log.DefaultLogger.Info("Circuit breaker half-open, probing warehouse")
+		b.state = circuitStateHalfOpen
+		b.probeAt = time.Now()
+		return nil
+	case circuitStateHalfOpen:
+		// Only one probe at a time, a probe which never reported back is replaced after openTimeout
+		if time.Since(b.probeAt) < b.openTimeout {
+			return b.openError()
+		}
+		b.probeAt = time.Now()
+		return nil
+	}
+	return nil
+}
+
+// available returns the error of allow without taking the probe of a half-open circuit, so queries can fail
+// fast before they wait for an admission slot.
+func (b *circuitBreaker) available(ctx context.Context) error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+	if bypass, _ := ctx.Value(circuitBreakerBypassKey{}).(bool); bypass {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitStateOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return b.openError()
+		}
+	case circuitStateHalfOpen:
+		if time.Since(b.probeAt) < b.openTimeout {
+			return b.openError()
+		}
+	}
+	return nil
+}
+
+func (b *circuitBreaker) openError() error {
+	retryIn := b.openTimeout - time.Since(b.openedAt)
+	if retryIn < 0 {
+		retryIn = 0
+	}
+	return newQueryError(errorCategoryWarehouseUnavailable, fmt.Errorf(
+		"circuit breaker open after %d consecutive connectivity failures, failing fast (next probe in %s): %w",
+		b.failures, retryIn.Round(time.Second), b.lastErr,
+	))
+}
+
+// record updates the circuit with the result of a statement. Only a success closes the circuit and only a
+// connectivity failure counts towards opening it, other errors (e.g. a syntax error, a timeout or a
+// cancellation) don't tell whether the warehouse is available and leave the circuit as it is.
+func (b *circuitBreaker) record(err error) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.state != circuitStateClosed {
+			log.DefaultLogger.Info("Circuit breaker closed, warehouse is available again")
+		}
+		b.state = circuitStateClosed
+		b.failures = 0
+		b.lastErr = nil
+		return
+	}
+	if !isConnectivityFailure(err) {
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	if b.state == circuitStateHalfOpen || (b.state == circuitStateClosed && b.failures >= b.threshold) {
+		log.DefaultLogger.Info("Circuit breaker opened", "failures", b.failures, "err", redactSecrets(err.Error()))
+		b.state = circuitStateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// get returns the state of the circuit, the number of consecutive failures and the last failure.
+func (b *circuitBreaker) get() (circuitState, int, error) {
+	if b == nil {
+		return circuitStateClosed, 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.failures, b.lastErr
+}
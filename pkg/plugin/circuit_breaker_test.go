@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerRecord(t *testing.T) {
+	unavailable := errors.New("unexpected response status 503 Service Unavailable")
+	tests := []struct {
+		name     string
+		results  []error
+		state    circuitState
+		failures int
+	}{
+		{"opens after threshold", []error{unavailable, unavailable}, circuitStateOpen, 2},
+		{"bad connection", []error{fmt.Errorf("query failed: %w", driver.ErrBadConn), unavailable}, circuitStateOpen, 2},
+		{"success resets", []error{unavailable, nil}, circuitStateClosed, 0},
+		{"syntax error keeps failures", []error{unavailable, errors.New("[PARSE_SYNTAX_ERROR] Syntax error at or near 'SELEC'")}, circuitStateClosed, 1},
+		{"canceled keeps failures", []error{unavailable, context.Canceled, unavailable}, circuitStateOpen, 2},
+		{"timeout keeps failures", []error{unavailable, context.DeadlineExceeded}, circuitStateClosed, 1},
+		{"invalid session", []error{unavailable, errors.New("Invalid SessionHandle")}, circuitStateClosed, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(2, time.Minute)
+			for _, err := range tt.results {
+				b.record(err)
+			}
+			state, failures, _ := b.get()
+			if state != tt.state || failures != tt.failures {
+				t.Errorf("expected %s with %d failures, got %s with %d failures", tt.state, tt.failures, state, failures)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerAvailable(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	ctx := context.Background()
+	if err := b.available(ctx); err != nil {
+		t.Fatalf("expected a closed circuit to be available, got %v", err)
+	}
+
+	b.record(newQueryError(errorCategoryWarehouseUnavailable, context.DeadlineExceeded))
+	if err := b.available(ctx); err == nil {
+		t.Fatal("expected an open circuit not to be available")
+	}
+	if err := b.available(withoutCircuitBreaker(ctx)); err != nil {
+		t.Fatalf("expected the bypass to be available, got %v", err)
+	}
+
+	// Once the open timeout passed, checking the circuit must not take the probe
+	b.openedAt = time.Now().Add(-2 * time.Minute)
+	if err := b.available(ctx); err != nil {
+		t.Fatalf("expected an expired open circuit to be available, got %v", err)
+	}
+	if state, _, _ := b.get(); state != circuitStateOpen {
+		t.Fatalf("expected the circuit to stay open, got %s", state)
+	}
+	if err := b.allow(ctx); err != nil {
+		t.Fatalf("expected the probe to be allowed, got %v", err)
+	}
+	if err := b.available(ctx); err == nil {
+		t.Fatal("expected a half-open circuit with a running probe not to be available")
+	}
+}
@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"sync"
+	"time"
+)
+
+type connectionState string
+
+const (
+	connectionStateStarting connectionState = "starting"
+	connectionStateReady    connectionState = "ready"
+	connectionStateFailed   connectionState = "failed"
+)
+
+// warmUpTimeout bounds the background warm-up, a stopped SQL warehouse can take several minutes to start.
+const warmUpTimeout = 10 * time.Minute
+
+// connectionStatus tracks the state of the connection to Databricks. It is updated by the background
+// warm-up and by every query afterwards, so it always reflects the last known connectivity.
+type connectionStatus struct {
+	mu    sync.RWMutex
+	state connectionState
+	err   error
+	since time.Time
+}
+
+func newConnectionStatus() *connectionStatus {
+	return &connectionStatus{
+		state: connectionStateStarting,
+		since: time.Now(),
+	}
+}
+
+func (s *connectionStatus) set(state connectionState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != state {
+		s.since = time.Now()
+	}
+	s.state = state
+	s.err = err
+}
+
+func (s *connectionStatus) get() (connectionState, error, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state, s.err, s.since
+}
+
+// observe updates the connection state from the result of a statement. Only connectivity related
+// errors mark the connection as failed, a syntax error still proves the connection is working.
+func (s *connectionStatus) observe(err error) {
+	if err == nil {
+		s.set(connectionStateReady, nil)
+		return
+	}
+	switch classifyError(err) {
+	case errorCategoryAuth, errorCategoryWarehouseUnavailable:
+		s.set(connectionStateFailed, err)
+	case errorCategorySyntax, errorCategoryExecution, errorCategoryPermission:
+		s.set(connectionStateReady, nil)
+	}
+}
+
+// annotate adds the connection state to an error, so users can tell a failing query on a
+// connection that is still warming up from one on an established connection.
+func (s *connectionStatus) annotate(err error) error {
+	state, stateErr, since := s.get()
+	switch state {
+	case connectionStateStarting:
+		return fmt.Errorf("connection is still starting (since %s, the SQL warehouse may be starting up): %w", since.Format(time.RFC3339), err)
+	case connectionStateFailed:
+		if stateErr != nil && stateErr.Error() != err.Error() {
+			return fmt.Errorf("connection failed (%s): %w", stateErr, err)
+		}
+	}
+	return err
+}
+
+// isPassThroughAuth returns true if the authentication method requires a token of the signed-in user,
+// which is not available outside a request.
+func isPassThroughAuth(authMethod string) bool {
+	return authMethod == "oauth2_pass_through" || authMethod == "azure_entra_pass_thru" || authMethod == "oauth2_token_exchange"
+}
+
+// startWarmUp opens the first connection of every endpoint in the background, so that creating the datasource
+// instance never blocks on a stopped or unreachable warehouse.
+func (d *Datasource) startWarmUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), warmUpTimeout)
+	d.cancelWarmUp = cancel
+
+	if isPassThroughAuth(d.authMethod) {
+		// Without a user token no connection can be opened, the state is updated by the first query
+		log.DefaultLogger.Info("Connection warm-up deferred until first request with user token")
+		cancel()
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range d.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.warmUp(ctx)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+}
+
+func (e *endpoint) warmUp(ctx context.Context) {
+	log.DefaultLogger.Info("Connection warm-up started", "path", e.path)
+	err := e.db.PingContext(ctx)
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return
+		}
+		log.DefaultLogger.Info("Connection warm-up failed", "path", e.path, "err", err)
+		e.status.set(connectionStateFailed, err)
+		return
+	}
+	log.DefaultLogger.Info("Connection warm-up completed", "path", e.path)
+	e.status.set(connectionStateReady, nil)
+}
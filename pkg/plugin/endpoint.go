@@ -0,0 +1,258 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"go.opentelemetry.io/otel/trace"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Strategies selecting the HTTP path of a query, if multiple paths are configured
+const (
+	endpointStrategyFailover      = "failover"
+	endpointStrategyRoundRobin    = "round_robin"
+	endpointStrategyLeastInFlight = "least_in_flight"
+)
+
+// endpoint is a single SQL warehouse (HTTP path) of the datasource with its own connector, connection pool,
+// connection state and circuit breaker.
+type endpoint struct {
+	d         *Datasource
+	path      string
+	connector driver.Connector
+	db        *sql.DB
+	status    *connectionStatus
+	breaker   *circuitBreaker
+	// inFlight is the number of queries currently running on the endpoint
+	inFlight atomic.Int64
+}
+
+func newEndpoint(d *Datasource, path string, connector driver.Connector) *endpoint {
+	db := sql.OpenDB(connector)
+	SetDatasourceSettings(db, d.connectionSettings)
+	return &endpoint{
+		d:         d,
+		path:      path,
+		connector: connector,
+		db:        db,
+		status:    newConnectionStatus(),
+		breaker:   newCircuitBreaker(d.connectionSettings.BreakerThreshold, d.connectionSettings.BreakerTimeout),
+	}
+}
+
+// parsePaths returns the primary HTTP path followed by the additional comma separated paths.
+func parsePaths(primary string, additional string) []string {
+	paths := []string{primary}
+	for _, path := range strings.Split(additional, ",") {
+		path = strings.TrimSpace(path)
+		if path != "" && path != primary {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func validateEndpointStrategy(strategy string) error {
+	switch strategy {
+	case "", endpointStrategyFailover, endpointStrategyRoundRobin, endpointStrategyLeastInFlight:
+		return nil
+	}
+	return fmt.Errorf("invalid path strategy: %s", strategy)
+}
+
+// refresh closes the idle connections of the pool after a session expired, as their sessions have likely
+// expired as well, and checks that a new session can be opened. The pool itself is kept, connections in use
+// with an expired session are discarded by their users.
+func (e *endpoint) refresh(ctx context.Context) error {
+	e.db.SetMaxIdleConns(0)
+	e.db.SetMaxIdleConns(e.d.connectionSettings.MaxIdleConns)
+
+	err := e.db.PingContext(ctx)
+	observeSessionRefresh(e.d.uid, err)
+	if err != nil {
+		log.DefaultLogger.Info("Ping Error (Could not ping Databricks)", "path", e.path, "err", err)
+		return err
+	}
+	log.DefaultLogger.Info("Refreshed Databricks SQL DB Connections", "path", e.path)
+	return nil
+}
+
+// execStatement executes a single statement without returning any rows, recording a span, the statement log,
+// the connection state and the circuit breaker.
+func (e *endpoint) execStatement(ctx context.Context, executor sqlExecutor, queryString string) (err error) {
+	ctx, span := startSpan(ctx, "databricks.ExecContext", attributeHTTPPath.String(e.path))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	statementCtx, statementID := withStatementID(ctx, span)
+	statementCtx, rateLimit := withRateLimitMarker(statementCtx)
+	_, err = executor.ExecContext(statementCtx, queryString)
+	err = rateLimit.wrap(err)
+	e.d.logStatement(ctx, queryString, statementID(), time.Since(start), err)
+	e.status.observe(err)
+	e.breaker.record(err)
+	return err
+}
+
+// queryStatement executes a single statement returning the rows, recording a span, the statement log,
+// the connection state and the circuit breaker.
+func (e *endpoint) queryStatement(ctx context.Context, executor sqlExecutor, queryString string) (rows *sql.Rows, err error) {
+	ctx, span := startSpan(ctx, "databricks.QueryContext", attributeHTTPPath.String(e.path))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	statementCtx, statementID := withStatementID(ctx, span)
+	statementCtx, rateLimit := withRateLimitMarker(statementCtx)
+	rows, err = executor.QueryContext(statementCtx, queryString)
+	err = rateLimit.wrap(err)
+	e.d.logStatement(ctx, queryString, statementID(), time.Since(start), err)
+	e.status.observe(err)
+	e.breaker.record(err)
+	return rows, err
+}
+
+// execContext executes a statement on the pool of the endpoint and refreshes the pool once if the session expired.
+func (e *endpoint) execContext(ctx context.Context, queryString string) error {
+	err := e.execStatement(ctx, e.db, queryString)
+	if isInvalidSession(err) {
+		trace.SpanFromContext(ctx).AddEvent("session_refresh")
+		if err := e.refresh(ctx); err != nil {
+			return err
+		}
+		return e.execStatement(ctx, e.db, queryString)
+	}
+	return err
+}
+
+// queryContext runs a query on the pool of the endpoint and refreshes the pool once if the session expired.
+func (e *endpoint) queryContext(ctx context.Context, queryString string) (*sql.Rows, error) {
+	rows, err := e.queryStatement(ctx, e.db, queryString)
+	if isInvalidSession(err) {
+		trace.SpanFromContext(ctx).AddEvent("session_refresh")
+		if err := e.refresh(ctx); err != nil {
+			return nil, err
+		}
+		return e.queryStatement(ctx, e.db, queryString)
+	}
+	return rows, err
+}
+
+// candidates returns the endpoints in the order they are tried, according to the path strategy.
+func (d *Datasource) candidates() []*endpoint {
+	candidates := make([]*endpoint, len(d.endpoints))
+	copy(candidates, d.endpoints)
+	switch d.endpointStrategy {
+	case endpointStrategyRoundRobin:
+		offset := int(d.roundRobin.Add(1)-1) % len(candidates)
+		candidates = append(candidates[offset:], candidates[:offset]...)
+	case endpointStrategyLeastInFlight:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].inFlight.Load() < candidates[j].inFlight.Load()
+		})
+	}
+	return candidates
+}
+
+// checkCircuits returns an error if the circuits of all candidates are open, so a query fails fast instead
+// of waiting for an admission slot first.
+func checkCircuits(ctx context.Context, candidates []*endpoint) error {
+	var err error
+	for _, e := range candidates {
+		if err = e.breaker.available(ctx); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// withEndpoint runs fn on the first available endpoint of candidates. If it fails with a connectivity error
+// or the warehouse is stopped, the next endpoint is tried.
+func (d *Datasource) withEndpoint(ctx context.Context, candidates []*endpoint, fn func(e *endpoint) error) error {
+	if len(candidates) == 0 {
+		return newQueryError(errorCategoryWarehouseUnavailable, errors.New("no healthy warehouse endpoint"))
+	}
+
+	var err error
+	for i, e := range candidates {
+		if i > 0 {
+			loggerFromContext(ctx).Info("Failing over to next HTTP path", "path", e.path, "err", redactSecrets(err.Error()))
+			trace.SpanFromContext(ctx).AddEvent("failover", trace.WithAttributes(attributeHTTPPath.String(e.path)))
+		}
+		if err = e.breaker.allow(ctx); err != nil {
+			continue
+		}
+		e.inFlight.Add(1)
+		err = fn(e)
+		e.inFlight.Add(-1)
+		if !isConnectivityFailure(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// close closes the connection pool of the endpoint.
+func (e *endpoint) close() {
+	if err := e.db.Close(); err != nil {
+		log.DefaultLogger.Error("Error closing DB connection", "path", e.path, "err", err)
+	}
+}
+
+func validateWarehouses(warehouses map[string]string) error {
+	for name, path := range warehouses {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("warehouse name must not be empty")
+		}
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("warehouse %s is missing the http path", name)
+		}
+	}
+	return nil
+}
+
+// warehouseEndpoint returns the endpoint of a named warehouse of the allowlist. The connector and pool of a
+// warehouse are created on first use, a warehouse which is also a configured HTTP path shares its endpoint.
+func (d *Datasource) warehouseEndpoint(name string) (*endpoint, error) {
+	path, ok := d.warehouses[name]
+	if !ok {
+		return nil, newQueryError(errorCategoryPermission, fmt.Errorf("warehouse %q is not allowed for this datasource", name))
+	}
+	for _, e := range d.endpoints {
+		if e.path == path {
+			return e, nil
+		}
+	}
+
+	d.warehouseMu.Lock()
+	defer d.warehouseMu.Unlock()
+	if e, ok := d.warehouseEndpoints[path]; ok {
+		return e, nil
+	}
+	connector, err := d.newConnector(path)
+	if err != nil {
+		return nil, err
+	}
+	log.DefaultLogger.Info("Init Databricks SQL DB for warehouse", "warehouse", name, "path", path)
+	e := newEndpoint(d, path, connector)
+	d.warehouseEndpoints[path] = e
+	return e, nil
+}
+
+// allEndpoints returns the configured endpoints and the endpoints of all warehouses used so far.
+func (d *Datasource) allEndpoints() []*endpoint {
+	d.warehouseMu.Lock()
+	defer d.warehouseMu.Unlock()
+	endpoints := make([]*endpoint, 0, len(d.endpoints)+len(d.warehouseEndpoints))
+	endpoints = append(endpoints, d.endpoints...)
+	for _, e := range d.warehouseEndpoints {
+		endpoints = append(endpoints, e)
+	}
+	return endpoints
+}
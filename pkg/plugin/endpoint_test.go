@@ -0,0 +1,20 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithEndpointWithoutCandidates(t *testing.T) {
+	d := &Datasource{}
+	err := d.withEndpoint(context.Background(), nil, func(*endpoint) error {
+		t.Fatal("expected no endpoint to be tried")
+		return nil
+	})
+	if err == nil || err.Error() != "no healthy warehouse endpoint" {
+		t.Fatalf("expected no healthy warehouse endpoint, got %v", err)
+	}
+	if category := classifyError(err); category != errorCategoryWarehouseUnavailable {
+		t.Errorf("expected category %q, got %q", errorCategoryWarehouseUnavailable, category)
+	}
+}
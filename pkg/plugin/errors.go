@@ -0,0 +1,192 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	dbsqlerr "github.com/databricks/databricks-sql-go/errors"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/mullerpeter/databricks-grafana/pkg/integrations"
+	"regexp"
+	"strings"
+)
+
+type errorCategory string
+
+const (
+	errorCategorySyntax               errorCategory = "syntax"
+	errorCategoryExecution            errorCategory = "execution"
+	errorCategoryPermission           errorCategory = "permission"
+	errorCategoryAuth                 errorCategory = "auth"
+	errorCategoryTimeout              errorCategory = "timeout"
+	errorCategoryCanceled             errorCategory = "canceled"
+	errorCategoryWarehouseUnavailable errorCategory = "warehouse_unavailable"
+	errorCategoryRateLimited          errorCategory = "rate_limited"
+	errorCategoryBusy                 errorCategory = "datasource_busy"
+	errorCategoryInternal             errorCategory = "internal"
+)
+
+// statusClientClosedRequest is the status of a query canceled by the client, e.g. a closed dashboard.
+const statusClientClosedRequest backend.Status = 499
+
+type errorCategoryInfo struct {
+	status  backend.Status
+	source  backend.ErrorSource
+	message string
+}
+
+var errorCategories = map[errorCategory]errorCategoryInfo{
+	errorCategorySyntax:               {backend.StatusBadRequest, backend.ErrorSourceDownstream, "Invalid query"},
+	errorCategoryExecution:            {backend.StatusInternal, backend.ErrorSourceDownstream, "Query execution failed"},
+	errorCategoryPermission:           {backend.StatusForbidden, backend.ErrorSourceDownstream, "Permission denied"},
+	errorCategoryAuth:                 {backend.StatusUnauthorized, backend.ErrorSourceDownstream, "Authentication failed"},
+	errorCategoryTimeout:              {backend.StatusTimeout, backend.ErrorSourceDownstream, "Query timed out"},
+	errorCategoryCanceled:             {statusClientClosedRequest, backend.ErrorSourceDownstream, "Query canceled"},
+	errorCategoryWarehouseUnavailable: {backend.StatusBadGateway, backend.ErrorSourceDownstream, "Databricks SQL warehouse unavailable"},
+	errorCategoryRateLimited:          {backend.StatusTooManyRequests, backend.ErrorSourceDownstream, "Rate limited by Databricks"},
+	errorCategoryBusy:                 {backend.StatusTooManyRequests, backend.ErrorSourcePlugin, "Datasource busy"},
+	errorCategoryInternal:             {backend.StatusInternal, backend.ErrorSourcePlugin, "Internal plugin error"},
+}
+
+// queryError is an error with an explicitly assigned category, used for errors raised by the plugin itself.
+type queryError struct {
+	category errorCategory
+	err      error
+}
+
+func newQueryError(category errorCategory, err error) error {
+	return &queryError{category: category, err: err}
+}
+
+func (e *queryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
+// sqlStateFromError returns the SQLSTATE of a Databricks execution error, if present.
+func sqlStateFromError(err error) string {
+	var execErr dbsqlerr.DBExecutionError
+	if errors.As(err, &execErr) {
+		return execErr.SqlState()
+	}
+	return ""
+}
+
+// errorMessagePatterns is used as a fallback for driver errors which don't carry a SQLSTATE,
+// e.g. HTTP errors returned while opening a session. Patterns are matched in order.
+var errorMessagePatterns = []struct {
+	category errorCategory
+	patterns []string
+}{
+	{errorCategoryRateLimited, []string{"status 429", "too many requests", "rate limit", "request_limit_exceeded"}},
+	{errorCategoryAuth, []string{"status 401", "unauthorized", "unauthenticated", "invalid access token", "token is missing", "invalid_client", "invalid_grant"}},
+	{errorCategoryPermission, []string{"status 403", "forbidden", "permission_denied", "insufficient_permissions", "does not have permission"}},
+	{errorCategoryWarehouseUnavailable, []string{"status 502", "status 503", "status 504", "temporarily_unavailable", "service unavailable", "connection refused", "no such host", "connection reset", "i/o timeout", "warehouse is stopped", "is not running", "error connecting"}},
+	{errorCategorySyntax, []string{"parse_syntax_error", "syntax error", "unresolved_column", "table_or_view_not_found", "unresolved_routine"}},
+}
+
+// classifyError determines the category of an error by its explicit category, error type, SQLSTATE and
+// finally its message.
+func classifyError(err error) errorCategory {
+	var qErr *queryError
+	if errors.As(err, &qErr) {
+		return qErr.category
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return errorCategoryCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorCategoryTimeout
+	}
+
+	// A failing token endpoint says nothing about the warehouse, it must neither open the circuit breaker
+	// nor trigger a failover
+	var tokenErr *integrations.TokenError
+	if errors.As(err, &tokenErr) {
+		return errorCategoryAuth
+	}
+
+	if sqlState := sqlStateFromError(err); len(sqlState) == 5 {
+		switch {
+		case sqlState == "42501":
+			return errorCategoryPermission
+		case sqlState == "57014":
+			return errorCategoryTimeout
+		case strings.HasPrefix(sqlState, "28"):
+			return errorCategoryAuth
+		case strings.HasPrefix(sqlState, "08"):
+			return errorCategoryWarehouseUnavailable
+		case strings.HasPrefix(sqlState, "53"):
+			return errorCategoryRateLimited
+		case strings.HasPrefix(sqlState, "42"), strings.HasPrefix(sqlState, "22"), strings.HasPrefix(sqlState, "0A"):
+			return errorCategorySyntax
+		}
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, entry := range errorMessagePatterns {
+		for _, pattern := range entry.patterns {
+			if strings.Contains(message, pattern) {
+				return entry.category
+			}
+		}
+	}
+
+	switch {
+	case errors.Is(err, dbsqlerr.ExecutionError):
+		return errorCategoryExecution
+	case errors.Is(err, dbsqlerr.RequestError):
+		return errorCategoryWarehouseUnavailable
+	}
+
+	return errorCategoryInternal
+}
+
+var errorClassPattern = regexp.MustCompile(`\[[A-Z][A-Z0-9_.]+\][^\n]*`)
+
+// shortErrorDetail extracts the most relevant line of an error message, preferring the Databricks
+// error class (e.g. "[PARSE_SYNTAX_ERROR] Syntax error at or near ...") over the driver's wrapping.
+func shortErrorDetail(err error) string {
+	message := err.Error()
+	if match := errorClassPattern.FindString(message); match != "" {
+		message = match
+	}
+	message = strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+	if len(message) > 300 {
+		message = message[:300] + "..."
+	}
+	return message
+}
+
+// errorResponse converts an error into a DataResponse with status and error source set by its category.
+// The response error holds a short message, the full error is attached as a notice to an empty frame so
+// it is available in the query inspector.
+func errorResponse(err error, queryString string) backend.DataResponse {
+	category := classifyError(err)
+	info := errorCategories[category]
+
+	frame := data.NewFrame("error")
+	frame.SetMeta(&data.FrameMeta{
+		ExecutedQueryString: queryString,
+		Notices: []data.Notice{{
+			Severity: data.NoticeSeverityError,
+			Text:     err.Error(),
+		}},
+		Custom: map[string]string{
+			"errorCategory": string(category),
+			"sqlState":      sqlStateFromError(err),
+		},
+	})
+
+	return backend.DataResponse{
+		Frames:      data.Frames{frame},
+		Error:       newQueryError(category, fmt.Errorf("%s: %s", info.message, shortErrorDetail(err))),
+		Status:      info.status,
+		ErrorSource: info.source,
+	}
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	dbsql "github.com/databricks/databricks-sql-go"
+	"github.com/mullerpeter/databricks-grafana/pkg/integrations"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorCategory
+	}{
+		{"deadline", fmt.Errorf("query failed: %w", context.DeadlineExceeded), errorCategoryTimeout},
+		{"canceled", fmt.Errorf("query failed: %w", context.Canceled), errorCategoryCanceled},
+		{"token error", fmt.Errorf("request error after 1 attempt(s): %w", &integrations.TokenError{Err: errors.New("token endpoint request failed with status 503: temporarily_unavailable")}), errorCategoryAuth},
+		{"warehouse unavailable", errors.New("unexpected response status 503 Service Unavailable"), errorCategoryWarehouseUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("expected category %q, got %q", tt.want, got)
+			}
+		})
+	}
+	if isConnectivityFailure(context.Canceled) {
+		t.Error("expected a canceled query not to be a connectivity failure")
+	}
+}
+
+func TestClassifyTokenEndpointUnavailable(t *testing.T) {
+	tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprint(w, `{"error":"temporarily_unavailable","error_description":"try again later"}`)
+	}))
+	defer tokenEndpoint.Close()
+
+	authenticator := integrations.NewOauth2ClientCredentialsWithOptions("client-id", "client-secret", tokenEndpoint.URL, nil, integrations.Oauth2ClientCredentialsOptions{
+		HTTPClient: tokenEndpoint.Client(),
+	})
+	connector, err := dbsql.NewConnector(
+		// Nothing listens on the warehouse port, reaching it would be a connectivity failure
+		dbsql.WithServerHostname("127.0.0.1"),
+		dbsql.WithPort(1),
+		dbsql.WithHTTPPath("/sql/1.0/warehouses/abc"),
+		dbsql.WithAuthenticator(authenticator),
+		dbsql.WithRetries(0, time.Millisecond, time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	err = db.PingContext(context.Background())
+	if err == nil {
+		t.Fatal("expected the connection to fail")
+	}
+	if category := classifyError(err); category != errorCategoryAuth {
+		t.Errorf("expected category %q, got %q: %s", errorCategoryAuth, category, err)
+	}
+	if isConnectivityFailure(err) {
+		t.Errorf("expected a failing token endpoint not to be a connectivity failure: %s", err)
+	}
+}
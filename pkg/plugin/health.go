@@ -0,0 +1,291 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	healthStepOk      = "ok"
+	healthStepFailed  = "failed"
+	healthStepSkipped = "skipped"
+)
+
+type healthStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// endpointHealth is the health of a single HTTP path.
+type endpointHealth struct {
+	Path            string          `json:"path"`
+	ConnectionState connectionState `json:"connectionState"`
+	ConnectionError string          `json:"connectionError,omitempty"`
+	Steps           []healthStep    `json:"steps"`
+	CurrentUser     string          `json:"currentUser,omitempty"`
+	CurrentCatalog  string          `json:"currentCatalog,omitempty"`
+	CurrentSchema   string          `json:"currentSchema,omitempty"`
+	LatencyMs       int64           `json:"latencyMs,omitempty"`
+	CircuitBreaker  circuitState    `json:"circuitBreaker"`
+	CircuitFailures int             `json:"circuitFailures,omitempty"`
+	CircuitError    string          `json:"circuitError,omitempty"`
+}
+
+type healthDetails struct {
+	Steps     []healthStep     `json:"steps"`
+	Endpoints []endpointHealth `json:"endpoints,omitempty"`
+}
+
+// healthDiagnostics runs the connection diagnostics step by step and stops at the first failing step,
+// so the config page shows exactly which layer is broken.
+type healthDiagnostics struct {
+	steps  []healthStep
+	failed *healthStep
+}
+
+// run executes a single diagnostic step. Once a step failed, all following steps are skipped.
+func (h *healthDiagnostics) run(name string, step func() (string, error)) {
+	if h.failed != nil {
+		h.steps = append(h.steps, healthStep{Name: name, Status: healthStepSkipped})
+		return
+	}
+
+	start := time.Now()
+	message, err := step()
+	result := healthStep{
+		Name:       name,
+		Status:     healthStepOk,
+		Message:    message,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = healthStepFailed
+		// Step errors are shown on the config page, e.g. the error of a token endpoint may echo credentials
+		result.Message = redactSecrets(err.Error())
+		log.DefaultLogger.Info("Health check step failed", "step", name, "err", result.Message)
+		h.failed = &result
+	}
+	h.steps = append(h.steps, result)
+}
+
+func (d *Datasource) checkDNS(ctx context.Context) (string, error) {
+	if d.proxy.usedFor(d.hostname) {
+		return fmt.Sprintf("%s is resolved by the proxy", d.hostname), nil
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, d.hostname)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s resolved to %s", d.hostname, strings.Join(addrs, ", ")), nil
+}
+
+func (d *Datasource) checkTLS(ctx context.Context) (string, error) {
+	if d.proxy.usedFor(d.hostname) {
+		return d.checkTLSThroughProxy(ctx)
+	}
+	tlsConfig := d.tlsConfig.Clone()
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	tlsConfig.ServerName = d.hostname
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 10 * time.Second},
+		Config:    tlsConfig,
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(d.hostname, strconv.Itoa(d.port)))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	return fmt.Sprintf("%s handshake completed", tls.VersionName(state.Version)), nil
+}
+
+// checkTLSThroughProxy sends a request through the proxy, as the TLS handshake can't be dialed directly.
+func (d *Datasource) checkTLSThroughProxy(ctx context.Context) (string, error) {
+	transport, err := newHTTPTransport(d.tlsConfig, d.proxy)
+	if err != nil {
+		return "", err
+	}
+	defer transport.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, "https://"+net.JoinHostPort(d.hostname, strconv.Itoa(d.port)), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	if resp.TLS == nil {
+		return "", fmt.Errorf("no TLS connection established through the proxy")
+	}
+	return fmt.Sprintf("%s handshake completed through the proxy", tls.VersionName(resp.TLS.Version)), nil
+}
+
+func (d *Datasource) checkAuthentication(ctx context.Context) (string, error) {
+	if d.authenticator == nil {
+		return "", fmt.Errorf("no authenticator configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+d.hostname, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := d.authenticator.Authenticate(req); err != nil {
+		return "", err
+	}
+	if req.Header.Get("Authorization") == "" {
+		return "", fmt.Errorf("authenticator did not provide an authorization header")
+	}
+	return fmt.Sprintf("credentials acquired (%s)", d.authMethodName()), nil
+}
+
+func (e *endpoint) checkSession(ctx context.Context) (string, error) {
+	conn, err := e.connector.Connect(ctx)
+	e.breaker.record(err)
+	if err != nil {
+		return "", err
+	}
+	if err := conn.Close(); err != nil {
+		log.DefaultLogger.Info("Health check session close failed", "err", err)
+	}
+	return "session opened", nil
+}
+
+func (e *endpoint) checkQuery(ctx context.Context, details *endpointHealth) (string, error) {
+	start := time.Now()
+	rows, err := e.queryContext(ctx, "SELECT current_user(), current_catalog(), current_schema()")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var currentUser, currentCatalog, currentSchema sql.NullString
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("test query returned no rows")
+	}
+	if err := rows.Scan(&currentUser, &currentCatalog, &currentSchema); err != nil {
+		return "", err
+	}
+
+	details.CurrentUser = currentUser.String
+	details.CurrentCatalog = currentCatalog.String
+	details.CurrentSchema = currentSchema.String
+	details.LatencyMs = time.Since(start).Milliseconds()
+	return fmt.Sprintf("test query completed in %dms", details.LatencyMs), nil
+}
+
+func (d *Datasource) authMethodName() string {
+	if d.authMethod == "" {
+		return "dsn"
+	}
+	return d.authMethod
+}
+
+// checkHealth opens a session and runs a test query on the endpoint. Every endpoint is checked independently.
+func (e *endpoint) checkHealth(ctx context.Context) (endpointHealth, *healthStep) {
+	details := endpointHealth{Path: e.path}
+	diagnostics := &healthDiagnostics{}
+	diagnostics.run("Session open", func() (string, error) { return e.checkSession(ctx) })
+	diagnostics.run("Test query", func() (string, error) { return e.checkQuery(ctx, &details) })
+	details.Steps = diagnostics.steps
+
+	state, stateErr, _ := e.status.get()
+	details.ConnectionState = state
+	if stateErr != nil {
+		details.ConnectionError = redactSecrets(stateErr.Error())
+	}
+	circuit, failures, circuitErr := e.breaker.get()
+	details.CircuitBreaker = circuit
+	details.CircuitFailures = failures
+	if circuitErr != nil {
+		details.CircuitError = redactSecrets(circuitErr.Error())
+	}
+	return details, diagnostics.failed
+}
+
+// healthMessage returns the message of a failed endpoint check, including the connection state and circuit breaker.
+func (e *endpoint) healthMessage(failed *healthStep) string {
+	message := fmt.Sprintf("%s failed: %s", failed.Name, failed.Message)
+	if state, _, since := e.status.get(); state == connectionStateStarting {
+		message = fmt.Sprintf("Connection is still starting (since %s). %s", since.Format(time.RFC3339), message)
+	}
+	if circuit, _, _ := e.breaker.get(); circuit != circuitStateClosed {
+		message = fmt.Sprintf("Circuit breaker %s, queries fail fast. %s", circuit, message)
+	}
+	if len(e.d.endpoints) > 1 {
+		message = fmt.Sprintf("HTTP path %s: %s", e.path, message)
+	}
+	return message
+}
+
+// runHealthDiagnostics checks DNS resolution, TLS handshake and authentication, followed by session open
+// and a test query on every HTTP path, and reports the result of every step in the JSON details.
+// The health check bypasses the circuit breaker, so it can be used to probe a recovered warehouse.
+func (d *Datasource) runHealthDiagnostics(ctx context.Context) *backend.CheckHealthResult {
+	ctx = withoutCircuitBreaker(ctx)
+	diagnostics := &healthDiagnostics{}
+	diagnostics.run("DNS resolution", func() (string, error) { return d.checkDNS(ctx) })
+	diagnostics.run("TLS handshake", func() (string, error) { return d.checkTLS(ctx) })
+	diagnostics.run("Authentication", func() (string, error) { return d.checkAuthentication(ctx) })
+
+	details := healthDetails{Steps: diagnostics.steps}
+	var messages []string
+	if diagnostics.failed != nil {
+		messages = append(messages, fmt.Sprintf("%s failed: %s", diagnostics.failed.Name, diagnostics.failed.Message))
+	} else {
+		for _, e := range d.endpoints {
+			endpointDetails, failed := e.checkHealth(ctx)
+			details.Endpoints = append(details.Endpoints, endpointDetails)
+			if failed != nil {
+				messages = append(messages, e.healthMessage(failed))
+			}
+		}
+	}
+
+	jsonDetails, err := json.Marshal(details)
+	if err != nil {
+		log.DefaultLogger.Error("Health check details could not be marshaled", "err", err)
+	}
+
+	if len(messages) > 0 {
+		return &backend.CheckHealthResult{
+			Status:      backend.HealthStatusError,
+			Message:     strings.Join(messages, "; "),
+			JSONDetails: jsonDetails,
+		}
+	}
+
+	primary := details.Endpoints[0]
+	message := fmt.Sprintf("Data source is working (user: %s, namespace: %s.%s, latency: %dms)",
+		primary.CurrentUser,
+		primary.CurrentCatalog,
+		primary.CurrentSchema,
+		primary.LatencyMs,
+	)
+	if len(details.Endpoints) > 1 {
+		message = fmt.Sprintf("%s, all %d HTTP paths available", message, len(details.Endpoints))
+	}
+	return &backend.CheckHealthResult{
+		Status:      backend.HealthStatusOk,
+		Message:     message,
+		JSONDetails: jsonDetails,
+	}
+}
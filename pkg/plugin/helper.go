@@ -58,7 +58,8 @@ func executeQuery(ctx context.Context, d *Datasource, query string, scanFunc fun
 
 func autocompletionQueries(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender, d *Datasource) error {
 	path := req.Path
-	log.DefaultLogger.Info("CallResource called", "path", path)
+	logger := loggerFromContext(ctx)
+	logger.Debug("CallResource called", "path", path)
 	var body schemaRequestBody
 	err := json.Unmarshal(req.Body, &body)
 	if err != nil {
@@ -86,7 +87,7 @@ func autocompletionQueries(ctx context.Context, req *backend.CallResourceRequest
 		if body.Catalog != "" {
 			queryString = fmt.Sprintf("SHOW SCHEMAS IN %s", body.Catalog)
 		}
-		log.DefaultLogger.Info("CallResource called", "queryString", queryString)
+		logger.Debug("CallResource called", "queryString", queryString)
 
 		schemas := make([]string, 0)
 		err = executeQuery(ctx, d, queryString, func(rows *sql.Rows) error {
@@ -110,7 +111,7 @@ func autocompletionQueries(ctx context.Context, req *backend.CallResourceRequest
 				queryString = fmt.Sprintf("SHOW TABLES IN %s.%s", body.Catalog, body.Schema)
 			}
 		}
-		log.DefaultLogger.Info("CallResource called", "queryString", queryString)
+		logger.Debug("CallResource called", "queryString", queryString)
 
 		tables := make([]string, 0)
 		err = executeQuery(ctx, d, queryString, func(rows *sql.Rows) error {
@@ -130,7 +131,7 @@ func autocompletionQueries(ctx context.Context, req *backend.CallResourceRequest
 		return sendJSONResponse(sender, 200, tables)
 	case "columns":
 		queryString := fmt.Sprintf("DESCRIBE TABLE %s", body.Table)
-		log.DefaultLogger.Info("CallResource called", "queryString", queryString)
+		logger.Debug("CallResource called", "queryString", queryString)
 
 		columnsResponse := make([]columnsResponseBody, 0)
 		err = executeQuery(ctx, d, queryString, func(rows *sql.Rows) error {
@@ -154,7 +155,7 @@ func autocompletionQueries(ctx context.Context, req *backend.CallResourceRequest
 		return sendJSONResponse(sender, 200, columnsResponse)
 	case "defaults":
 		queryString := "SELECT current_catalog(), current_schema();"
-		log.DefaultLogger.Info("CallResource called", "queryString", queryString)
+		logger.Debug("CallResource called", "queryString", queryString)
 		rows, err := d.QueryContext(ctx, queryString)
 		if err != nil {
 			log.DefaultLogger.Error("CallResource Error", "err", err)
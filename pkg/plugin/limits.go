@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryLimits returns the timeout and row limit of a query. Values set on the query override the
+// datasource defaults, both are capped by the limits configured by the admin. A row limit of -1 means
+// no limit, a timeout of 0 means no timeout.
+func (d *Datasource) queryLimits(qm queryModel) (time.Duration, int64) {
+	settings := d.connectionSettings
+
+	timeout := settings.Timeout
+	if qm.Timeout > 0 {
+		timeout = time.Duration(qm.Timeout) * time.Second
+	}
+	if settings.MaxQueryTimeout > 0 && (timeout == 0 || timeout > settings.MaxQueryTimeout) {
+		timeout = settings.MaxQueryTimeout
+	}
+
+	// The datasource MaxRows is the fetch size of the driver, without a limit on the query or by the admin
+	// all rows are returned
+	rowLimit := int64(-1)
+	if qm.MaxRows > 0 {
+		rowLimit = int64(qm.MaxRows)
+	}
+	if settings.MaxQueryRows > 0 && (rowLimit < 0 || rowLimit > int64(settings.MaxQueryRows)) {
+		rowLimit = int64(settings.MaxQueryRows)
+	}
+	return timeout, rowLimit
+}
+
+// setStatementTimeout sets the server side statement timeout of the session, if it differs from the
+// datasource default which the driver already applies to every statement. The timeout configured as
+// session parameter of the datasource is restored afterwards.
+func (s *querySession) setStatementTimeout(ctx context.Context, timeout time.Duration) error {
+	if timeout <= 0 || timeout == s.d.connectionSettings.Timeout {
+		return nil
+	}
+	seconds := int64(timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	restore := "RESET STATEMENT_TIMEOUT"
+	if configured, ok := s.d.sessionParameter("STATEMENT_TIMEOUT"); ok {
+		if configuredSeconds, err := strconv.Atoi(strings.Trim(configured, "'")); err == nil {
+			restore = fmt.Sprintf("SET STATEMENT_TIMEOUT = %d", configuredSeconds)
+		}
+	}
+	return s.set(ctx, fmt.Sprintf("SET STATEMENT_TIMEOUT = %d", seconds), restore)
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"context"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are request headers which can carry credentials, e.g. the forwarded OAuth identity token.
+var sensitiveHeaders = []string{"authorization", "cookie", "x-id-token", "x-grafana-id", "token", "secret", "password"}
+
+// secretPatterns match credentials which may end up in error messages or SQL text.
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)((?:client_secret|client_assertion|access_token|refresh_token|id_token|password)["']?\s*[=:]\s*["']?)[^\s&"',]+`), "${1}" + redacted},
+	{regexp.MustCompile(`dapi[0-9a-f]{32}(-\d+)?`), redacted},
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+}
+
+// redactSecrets replaces tokens and secrets in s.
+func redactSecrets(s string) string {
+	for _, secret := range secretPatterns {
+		s = secret.pattern.ReplaceAllString(s, secret.replacement)
+	}
+	return s
+}
+
+// redactHeaders returns a copy of headers with the values of all credential carrying headers replaced.
+func redactHeaders(headers map[string]string) map[string]string {
+	result := make(map[string]string, len(headers))
+	for key, value := range headers {
+		result[key] = redactSecrets(value)
+		lowerKey := strings.ToLower(key)
+		for _, sensitive := range sensitiveHeaders {
+			if strings.Contains(lowerKey, sensitive) {
+				result[key] = redacted
+				break
+			}
+		}
+	}
+	return result
+}
+
+// withQueryLogAttributes adds the fields identifying a single query to all log lines using the returned context.
+// The SDK already adds the datasource UID and the trace ID.
+func withQueryLogAttributes(ctx context.Context, pCtx backend.PluginContext, refID string) context.Context {
+	attributes := []any{"refId", refID}
+	if pCtx.User != nil {
+		attributes = append(attributes, "userLogin", pCtx.User.Login)
+	}
+	return log.WithContextualAttributes(ctx, attributes)
+}
+
+// loggerFromContext returns the default logger with all contextual attributes of ctx.
+func loggerFromContext(ctx context.Context) log.Logger {
+	return log.DefaultLogger.FromContext(ctx)
+}
+
+// logStatement logs an executed statement. The SQL text is only logged, on Info level, if the datasource
+// has SQL audit logging enabled. Otherwise only the statement ID and duration are logged on Debug level.
+func (d *Datasource) logStatement(ctx context.Context, statement string, statementID string, duration time.Duration, err error) {
+	args := []any{
+		"statementId", statementID,
+		"duration", duration.String(),
+	}
+	if err != nil {
+		args = append(args, "err", redactSecrets(err.Error()))
+	}
+
+	logger := loggerFromContext(ctx)
+	if d.logSql {
+		logger.Info("Statement executed", append(args, "sql", redactSecrets(statement))...)
+		return
+	}
+	logger.Debug("Statement executed", args...)
+}
@@ -0,0 +1,217 @@
+package plugin
+
+import (
+	"encoding/json"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sync"
+	"time"
+)
+
+// Metrics are registered on the default registry, which is exposed by the SDK on the plugin metrics endpoint.
+const (
+	metricsNamespace = "grafana_plugin"
+	metricsSubsystem = "databricks"
+)
+
+const (
+	queryKindData     = "data"
+	queryKindResource = "resource"
+	queryKindHealth   = "health"
+
+	outcomeSuccess = "success"
+	outcomeError   = "error"
+
+	rateLimitOutcomeWaited   = "waited"
+	rateLimitOutcomeRejected = "rejected"
+)
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "query_duration_seconds",
+		Help:      "Duration of queries by datasource, query kind and outcome.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"datasource_uid", "kind", "outcome"})
+
+	rowsReturned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "rows_returned_total",
+		Help:      "Number of rows returned to Grafana.",
+	}, []string{"datasource_uid"})
+
+	bytesReturned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "bytes_returned_total",
+		Help:      "Estimated size of the data frames returned to Grafana in bytes.",
+	}, []string{"datasource_uid"})
+
+	sessionRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "session_refreshes_total",
+		Help:      "Number of connection pool refreshes (closing the idle connections) after an invalid session handle.",
+	}, []string{"datasource_uid", "outcome"})
+
+	rateLimits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "rate_limited_total",
+		Help:      "Number of HTTP 429/503 responses with Retry-After, by whether the plugin waited or the wait exceeded the query deadline.",
+	}, []string{"datasource_uid", "outcome"})
+
+	pools = newPoolCollector()
+)
+
+func init() {
+	prometheus.MustRegister(pools)
+}
+
+// outcomeFromError returns the outcome label of a query, which is the error category for failed queries.
+func outcomeFromError(err error) string {
+	if err == nil {
+		return outcomeSuccess
+	}
+	return string(classifyError(err))
+}
+
+func observeQueryDuration(uid, kind, outcome string, start time.Time) {
+	queryDuration.WithLabelValues(uid, kind, outcome).Observe(time.Since(start).Seconds())
+}
+
+func observeFrame(uid string, frame *data.Frame) {
+	rows, err := frame.RowLen()
+	if err != nil {
+		return
+	}
+	rowsReturned.WithLabelValues(uid).Add(float64(rows))
+	bytesReturned.WithLabelValues(uid).Add(float64(frameSize(frame)))
+}
+
+// frameSize estimates the size of the values of a frame, fixed width values by their width and strings by
+// their length. Encoding the frame only to measure it would double the work for every response.
+func frameSize(frame *data.Frame) int {
+	size := 0
+	for _, field := range frame.Fields {
+		switch field.Type().NonNullableType() {
+		case data.FieldTypeString:
+			for i := 0; i < field.Len(); i++ {
+				if value, ok := field.ConcreteAt(i); ok {
+					size += len(value.(string))
+				}
+			}
+		case data.FieldTypeJSON:
+			for i := 0; i < field.Len(); i++ {
+				if value, ok := field.ConcreteAt(i); ok {
+					size += len(value.(json.RawMessage))
+				}
+			}
+		case data.FieldTypeInt8, data.FieldTypeUint8, data.FieldTypeBool:
+			size += field.Len()
+		case data.FieldTypeInt16, data.FieldTypeUint16:
+			size += 2 * field.Len()
+		case data.FieldTypeInt32, data.FieldTypeUint32, data.FieldTypeFloat32:
+			size += 4 * field.Len()
+		default:
+			size += 8 * field.Len()
+		}
+	}
+	return size
+}
+
+func observeSessionRefresh(uid string, err error) {
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeError
+	}
+	sessionRefreshes.WithLabelValues(uid, outcome).Inc()
+}
+
+func observeRateLimit(uid, outcome string) {
+	rateLimits.WithLabelValues(uid, outcome).Inc()
+}
+
+// poolCollector exposes the sql.DB connection pool statistics of all active datasource instances.
+type poolCollector struct {
+	mu          sync.RWMutex
+	datasources map[string]*Datasource
+
+	openConnections *prometheus.Desc
+	inUse           *prometheus.Desc
+	idle            *prometheus.Desc
+	waitCount       *prometheus.Desc
+	waitDuration    *prometheus.Desc
+	running         *prometheus.Desc
+	queued          *prometheus.Desc
+}
+
+func newPoolCollector() *poolCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, metricsSubsystem, name),
+			help,
+			append([]string{"datasource_uid"}, labels...),
+			nil,
+		)
+	}
+	return &poolCollector{
+		datasources:     map[string]*Datasource{},
+		openConnections: desc("pool_open_connections", "Number of established connections, both in use and idle.", "http_path"),
+		inUse:           desc("pool_in_use_connections", "Number of connections currently in use.", "http_path"),
+		idle:            desc("pool_idle_connections", "Number of idle connections.", "http_path"),
+		waitCount:       desc("pool_wait_count_total", "Total number of connections waited for.", "http_path"),
+		waitDuration:    desc("pool_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", "http_path"),
+		running:         desc("admission_running_queries", "Number of queries admitted by the concurrency limit."),
+		queued:          desc("admission_queued_queries", "Number of queries waiting for the concurrency limit."),
+	}
+}
+
+func (c *poolCollector) register(uid string, d *Datasource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.datasources[uid] = d
+}
+
+// unregister removes the datasource, unless it was already replaced by a newer instance with the same UID.
+func (c *poolCollector) unregister(uid string, d *Datasource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.datasources[uid] == d {
+		delete(c.datasources, uid)
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openConnections
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.running
+	ch <- c.queued
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for uid, d := range c.datasources {
+		if len(d.endpoints) == 0 {
+			continue
+		}
+		for _, e := range d.allEndpoints() {
+			stats := e.db.Stats()
+			ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(stats.OpenConnections), uid, e.path)
+			ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse), uid, e.path)
+			ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle), uid, e.path)
+			ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), uid, e.path)
+			ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), uid, e.path)
+		}
+		running, queued := d.admission.stats()
+		ch <- prometheus.MustNewConstMetric(c.running, prometheus.GaugeValue, float64(running), uid)
+		ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(queued), uid)
+	}
+}
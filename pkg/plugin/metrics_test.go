@@ -0,0 +1,23 @@
+package plugin
+
+import (
+	"encoding/json"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"testing"
+	"time"
+)
+
+func TestFrameSize(t *testing.T) {
+	name := "b"
+	frame := data.NewFrame("response",
+		data.NewField("time", nil, []time.Time{time.Now(), time.Now()}),
+		data.NewField("value", nil, []float64{1, 2}),
+		data.NewField("count", nil, []int32{1, 2}),
+		data.NewField("name", nil, []*string{nil, &name}),
+		data.NewField("tags", nil, []string{"abc", "de"}),
+		data.NewField("json", nil, []json.RawMessage{json.RawMessage(`{}`), json.RawMessage(`[1]`)}),
+	)
+	if size, want := frameSize(frame), 2*8+2*8+2*4+1+5+5; size != want {
+		t.Errorf("expected %d bytes, got %d", want, size)
+	}
+}
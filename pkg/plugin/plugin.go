@@ -2,21 +2,27 @@ package plugin
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
 	dbsql "github.com/databricks/databricks-sql-go"
 	"github.com/databricks/databricks-sql-go/auth"
-	"github.com/databricks/databricks-sql-go/auth/oauth/m2m"
+	"github.com/databricks/databricks-sql-go/auth/pat"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana-plugin-sdk-go/data/sqlutil"
 	"github.com/mullerpeter/databricks-grafana/pkg/integrations"
+	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -44,6 +50,41 @@ type DatasourceSettings struct {
 	ClientId               string `json:"clientId"`
 	ExternalCredentialsUrl string `json:"externalCredentialsUrl"`
 	OAuthScopes            string `json:"oauthScopes"`
+	LogSql                 bool   `json:"logSql"`
+	QueryAttribution       bool   `json:"queryAttribution"`
+	DefaultCatalog         string `json:"defaultCatalog"`
+	DefaultSchema          string `json:"defaultSchema"`
+	// SessionParameters are set on every new session, e.g. {"TIMEZONE": "UTC", "ANSI_MODE": "true"}
+	SessionParameters map[string]string `json:"sessionParameters"`
+	DemoMode          string            `json:"demoMode"`
+	FixturesPath      string            `json:"fixturesPath"`
+	ReplayTimeShift   bool              `json:"replayTimeShift"`
+	// AdditionalPaths are comma separated HTTP paths of further SQL warehouses, selected by PathStrategy
+	AdditionalPaths string `json:"additionalPaths"`
+	PathStrategy    string `json:"pathStrategy"`
+	// Warehouses is the allowlist of named SQL warehouses (name to HTTP path) a query can select
+	Warehouses map[string]string `json:"warehouses"`
+	// TokenFile is the projected service account token used by workload identity, defaults to AZURE_FEDERATED_TOKEN_FILE.
+	// It must be located in integrations.WorkloadIdentityTokenDir
+	TokenFile string `json:"tokenFile"`
+	// TenantId is the Entra tenant of the Azure service principal
+	TenantId string `json:"tenantId"`
+	// TokenExchangeAudience and SubjectTokenType configure the token exchange of the forwarded user token
+	TokenExchangeAudience string `json:"tokenExchangeAudience"`
+	SubjectTokenType      string `json:"subjectTokenType"`
+	// OAuthAudience, OAuthResource and OAuthAuthStyle are optional settings of the client credentials flow
+	OAuthAudience  string `json:"oauthAudience"`
+	OAuthResource  string `json:"oauthResource"`
+	OAuthAuthStyle string `json:"oauthAuthStyle"`
+	// TLSMinVersion (1.2 or 1.3) and TLSSkipVerify apply to the connector and the OAuth token requests,
+	// the CA bundle and client certificate are stored in the secure JSON data
+	TLSMinVersion string `json:"tlsMinVersion"`
+	TLSSkipVerify bool   `json:"tlsSkipVerify"`
+	// ProxyUrl is an explicit HTTP(S) or SOCKS5 proxy, hosts of the comma separated NoProxy list are
+	// connected directly. The proxy password is stored in the secure JSON data
+	ProxyUrl      string `json:"proxyUrl"`
+	ProxyUsername string `json:"proxyUsername"`
+	NoProxy       string `json:"noProxy"`
 }
 
 type ConnectionSettingsRawJson struct {
@@ -56,6 +97,13 @@ type ConnectionSettingsRawJson struct {
 	MaxRetryDuration string `json:"maxRetryDuration"`
 	Timeout          string `json:"timeout"`
 	MaxRows          string `json:"maxRows"`
+	MaxQueryTimeout  string `json:"maxQueryTimeout"`
+	MaxQueryRows     string `json:"maxQueryRows"`
+	MaxConcurrent    string `json:"maxConcurrentQueries"`
+	MaxQueued        string `json:"maxQueuedQueries"`
+	QueueTimeout     string `json:"queueTimeout"`
+	BreakerThreshold string `json:"circuitBreakerThreshold"`
+	BreakerTimeout   string `json:"circuitBreakerTimeout"`
 }
 
 type ConnectionSettings struct {
@@ -68,6 +116,18 @@ type ConnectionSettings struct {
 	MaxRetryDuration time.Duration
 	Timeout          time.Duration
 	MaxRows          int
+	// MaxQueryTimeout and MaxQueryRows cap the timeout and row limit of a single query (0 = no limit)
+	MaxQueryTimeout time.Duration
+	MaxQueryRows    int
+	// MaxConcurrent limits the concurrent statements (0 = unlimited), further requests wait in a queue
+	// of MaxQueued requests for at most QueueTimeout
+	MaxConcurrent int
+	MaxQueued     int
+	QueueTimeout  time.Duration
+	// BreakerThreshold consecutive connectivity failures open the circuit breaker (0 = disabled),
+	// BreakerTimeout is the time until the next probe
+	BreakerThreshold int
+	BreakerTimeout   time.Duration
 }
 
 // validateField checks if a field is empty and returns an error if it is.
@@ -88,6 +148,28 @@ func NewSampleDatasource(ctx context.Context, settings backend.DataSourceInstanc
 		return nil, err
 	}
 
+	var fixtures *fixtureStore
+	switch datasourceSettings.DemoMode {
+	case demoModeRecord, demoModeReplay:
+		if err := validateConnectionSetting(datasourceSettings.FixturesPath, "Fixtures Path"); err != nil {
+			return nil, err
+		}
+		fixtures = newFixtureStore(datasourceSettings.FixturesPath, datasourceSettings.ReplayTimeShift)
+	case "":
+	default:
+		log.DefaultLogger.Info("unknown demo mode", "err", nil)
+		return nil, fmt.Errorf("unknown demo mode: %s", datasourceSettings.DemoMode)
+	}
+
+	// In replay mode no connection to Databricks is established, all queries are served from fixtures
+	if datasourceSettings.DemoMode == demoModeReplay {
+		log.DefaultLogger.Info("Init Databricks replay datasource", "fixturesPath", datasourceSettings.FixturesPath)
+		return &Datasource{
+			demoMode: datasourceSettings.DemoMode,
+			fixtures: fixtures,
+		}, nil
+	}
+
 	connectionSettings := parseConnectionSettings(settings.JSONData)
 	port := 443
 	if datasourceSettings.Port != "" {
@@ -107,110 +189,308 @@ func NewSampleDatasource(ctx context.Context, settings backend.DataSourceInstanc
 		return nil, err
 	}
 
+	if err := validateEndpointStrategy(datasourceSettings.PathStrategy); err != nil {
+		return nil, err
+	}
+
+	if err := validateWarehouses(datasourceSettings.Warehouses); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(datasourceSettings, settings.DecryptedSecureJSONData)
+	if err != nil {
+		log.DefaultLogger.Info("Invalid TLS settings", "err", err)
+		return nil, err
+	}
+	proxy, err := newProxySettings(ctx, settings, datasourceSettings)
+	if err != nil {
+		log.DefaultLogger.Info("Invalid proxy settings", "err", err)
+		return nil, err
+	}
+	oauthClient, err := newOAuthClient(tlsConfig, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var authenticator auth.Authenticator
+
 	switch datasourceSettings.AuthenticationMethod {
-	case "m2m", "oauth2_client_credentials", "azure_entra_pass_thru", "oauth2_pass_through":
-		var authenticator auth.Authenticator
+	case "oauth2_client_credentials":
 
-		switch datasourceSettings.AuthenticationMethod {
-		case "oauth2_client_credentials":
+		if err := validateConnectionSetting(datasourceSettings.ExternalCredentialsUrl, "OAuth Credentials URL"); err != nil {
+			return nil, err
+		}
 
-			if err := validateConnectionSetting(datasourceSettings.ExternalCredentialsUrl, "OAuth Credentials URL"); err != nil {
-				return nil, err
-			}
+		if err := validateConnectionSetting(datasourceSettings.ClientId, "Client Id"); err != nil {
+			return nil, err
+		}
 
-			if err := validateConnectionSetting(datasourceSettings.ClientId, "Client Id"); err != nil {
-				return nil, err
-			}
+		if err := validateConnectionSetting(settings.DecryptedSecureJSONData["clientSecret"], "Client Secret"); err != nil {
+			return nil, err
+		}
 
-			if err := validateConnectionSetting(settings.DecryptedSecureJSONData["clientSecret"], "Client Secret"); err != nil {
-				return nil, err
-			}
+		if err := integrations.ValidateAuthStyle(datasourceSettings.OAuthAuthStyle); err != nil {
+			return nil, err
+		}
+		scopes, err := integrations.ParseScopes(datasourceSettings.OAuthScopes)
+		if err != nil {
+			return nil, err
+		}
 
-			authenticator = integrations.NewOauth2ClientCredentials(
-				datasourceSettings.ClientId,
-				settings.DecryptedSecureJSONData["clientSecret"],
-				datasourceSettings.ExternalCredentialsUrl,
-				strings.Split(datasourceSettings.OAuthScopes, ","),
-			)
-		case "m2m":
-			if err := validateConnectionSetting(datasourceSettings.ClientId, "Client Id"); err != nil {
+		authenticator = integrations.NewOauth2ClientCredentialsWithOptions(
+			datasourceSettings.ClientId,
+			settings.DecryptedSecureJSONData["clientSecret"],
+			datasourceSettings.ExternalCredentialsUrl,
+			scopes,
+			integrations.Oauth2ClientCredentialsOptions{
+				Audience:   datasourceSettings.OAuthAudience,
+				Resource:   datasourceSettings.OAuthResource,
+				AuthStyle:  datasourceSettings.OAuthAuthStyle,
+				HTTPClient: oauthClient,
+			},
+		)
+	case "m2m":
+		if err := validateConnectionSetting(datasourceSettings.ClientId, "Client Id"); err != nil {
+			return nil, err
+		}
+		if err := validateConnectionSetting(settings.DecryptedSecureJSONData["clientSecret"], "Client Secret"); err != nil {
+			return nil, err
+		}
+		authenticator = integrations.NewDatabricksM2M(
+			datasourceSettings.ClientId,
+			settings.DecryptedSecureJSONData["clientSecret"],
+			datasourceSettings.Hostname,
+			[]string{},
+			oauthClient,
+		)
+	case "azure_managed_identity":
+		// The Client ID selects a user-assigned identity, without it the system-assigned identity is used.
+		// The instance metadata service is link-local and is never reached through the proxy
+		authenticator = integrations.NewAzureManagedIdentity(datasourceSettings.ClientId, "", nil)
+	case "oauth2_private_key_jwt":
+		if err := validateConnectionSetting(datasourceSettings.ClientId, "Client Id"); err != nil {
+			return nil, err
+		}
+		if err := validateConnectionSetting(settings.DecryptedSecureJSONData["clientPrivateKey"], "Client Private Key"); err != nil {
+			return nil, err
+		}
+		scopes, err := integrations.ParseScopes(datasourceSettings.OAuthScopes)
+		if err != nil {
+			return nil, err
+		}
+		// With a tenant the Entra token endpoint and the Azure Databricks scope are used by default
+		tokenUrl := datasourceSettings.ExternalCredentialsUrl
+		if tokenUrl == "" && datasourceSettings.TenantId != "" {
+			if err := integrations.ValidateAzureTenantID(datasourceSettings.TenantId); err != nil {
 				return nil, err
 			}
-			if err := validateConnectionSetting(settings.DecryptedSecureJSONData["clientSecret"], "Client Secret"); err != nil {
+			tokenUrl = integrations.AzureTokenUrl(datasourceSettings.TenantId)
+			if len(scopes) == 0 {
+				scopes = []string{integrations.AzureDatabricksScope()}
+			}
+		}
+		if err := validateConnectionSetting(tokenUrl, "OAuth Credentials URL"); err != nil {
+			return nil, err
+		}
+		authenticator, err = integrations.NewOauth2PrivateKeyJWT(
+			datasourceSettings.ClientId,
+			tokenUrl,
+			scopes,
+			settings.DecryptedSecureJSONData["clientPrivateKey"],
+			settings.DecryptedSecureJSONData["clientCertificate"],
+			oauthClient,
+		)
+		if err != nil {
+			log.DefaultLogger.Info("Invalid private key JWT settings", "err", err)
+			return nil, err
+		}
+	case "azure_service_principal":
+		authenticator, err = integrations.NewAzureServicePrincipal(
+			datasourceSettings.TenantId,
+			datasourceSettings.ClientId,
+			settings.DecryptedSecureJSONData["clientSecret"],
+			oauthClient,
+		)
+		if err != nil {
+			log.DefaultLogger.Info("Invalid Azure Service Principal settings", "err", err)
+			return nil, err
+		}
+	case "workload_identity":
+		if err := validateConnectionSetting(datasourceSettings.ClientId, "Client Id"); err != nil {
+			return nil, err
+		}
+		// A configured token file is restricted to the secrets directory, the environment is set by the operator
+		tokenFile := datasourceSettings.TokenFile
+		if tokenFile != "" {
+			if err := integrations.ValidateTokenFile(tokenFile); err != nil {
 				return nil, err
 			}
-			authenticator = m2m.NewAuthenticatorWithScopes(
-				datasourceSettings.ClientId,
-				settings.DecryptedSecureJSONData["clientSecret"],
-				datasourceSettings.Hostname,
-				[]string{},
-			)
-		case "oauth2_pass_through", "azure_entra_pass_thru":
-			authenticator = integrations.NewOAuthPassThroughAuthenticator()
+		} else {
+			tokenFile = os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+		}
+		if err := validateConnectionSetting(tokenFile, "Token File"); err != nil {
+			return nil, err
+		}
+		scopes, err := integrations.ParseScopes(datasourceSettings.OAuthScopes)
+		if err != nil {
+			return nil, err
+		}
+		// Without a token endpoint the token is exchanged at the Databricks workspace (workload identity federation)
+		if datasourceSettings.ExternalCredentialsUrl == "" {
+			if len(scopes) == 0 {
+				scopes = []string{"all-apis"}
+			}
+			tokenUrl := fmt.Sprintf("https://%s/oidc/v1/token", datasourceSettings.Hostname)
+			authenticator = integrations.NewDatabricksWorkloadIdentity(datasourceSettings.ClientId, tokenFile, tokenUrl, scopes, oauthClient)
+			break
+		}
+		if len(scopes) == 0 {
+			scopes = []string{integrations.AzureDatabricksScope()}
+		}
+		authenticator = integrations.NewWorkloadIdentity(datasourceSettings.ClientId, tokenFile, datasourceSettings.ExternalCredentialsUrl, scopes, oauthClient)
+	case "oauth2_token_exchange":
+		if err := validateConnectionSetting(datasourceSettings.ExternalCredentialsUrl, "OAuth Credentials URL"); err != nil {
+			return nil, err
+		}
+		switch datasourceSettings.SubjectTokenType {
+		case "", integrations.TokenTypeAccessToken, integrations.TokenTypeIDToken, integrations.TokenTypeJWT:
 		default:
-			log.DefaultLogger.Info("unknown authentication method", "err", nil)
-			return nil, fmt.Errorf("unknown authentication method: %s", datasourceSettings.AuthenticationMethod)
+			return nil, fmt.Errorf("invalid subject token type: %s", datasourceSettings.SubjectTokenType)
 		}
-
-		connector, err := dbsql.NewConnector(
-			dbsql.WithServerHostname(datasourceSettings.Hostname),
-			dbsql.WithHTTPPath(datasourceSettings.Path),
-			dbsql.WithPort(port),
-			dbsql.WithAuthenticator(authenticator),
-			dbsql.WithTimeout(connectionSettings.Timeout),
-			dbsql.WithMaxRows(connectionSettings.MaxRows),
-			dbsql.WithRetries(connectionSettings.Retries, connectionSettings.RetryBackoff, connectionSettings.MaxRetryDuration),
+		scopes, err := integrations.ParseScopes(datasourceSettings.OAuthScopes)
+		if err != nil {
+			return nil, err
+		}
+		authenticator = integrations.NewOAuth2TokenExchangeAuthenticator(
+			datasourceSettings.ExternalCredentialsUrl,
+			datasourceSettings.ClientId,
+			settings.DecryptedSecureJSONData["clientSecret"],
+			datasourceSettings.TokenExchangeAudience,
+			scopes,
+			datasourceSettings.SubjectTokenType,
+			oauthClient,
 		)
+	case "gcp_id_token":
+		if err := validateConnectionSetting(settings.DecryptedSecureJSONData["gcpServiceAccountKey"], "GCP Service Account Key"); err != nil {
+			return nil, err
+		}
+		// The ID token audience defaults to the workspace URL
+		audience := datasourceSettings.OAuthAudience
+		if audience == "" {
+			audience = "https://" + datasourceSettings.Hostname
+		}
+		authenticator, err = integrations.NewGCPIDToken(settings.DecryptedSecureJSONData["gcpServiceAccountKey"], audience, oauthClient)
 		if err != nil {
-			log.DefaultLogger.Info("Connector Error", "err", err)
+			log.DefaultLogger.Info("Invalid GCP service account key", "err", err)
 			return nil, err
 		}
+	case "oauth2_pass_through", "azure_entra_pass_thru":
+		authenticator = integrations.NewOAuthPassThroughAuthenticator()
+	case "dsn", "":
+		authenticator = &pat.PATAuth{
+			AccessToken: settings.DecryptedSecureJSONData["token"],
+		}
+	default:
+		log.DefaultLogger.Info("Invalid Authentication Method", "err", nil)
+		return nil, fmt.Errorf("invalid authentication method: %s", datasourceSettings.AuthenticationMethod)
+	}
+
+	if err := validateSessionParameters(datasourceSettings.SessionParameters); err != nil {
+		return nil, err
+	}
 
-		log.DefaultLogger.Info("Init Databricks SQL DB")
-		databricksDB := sql.OpenDB(connector)
+	datasource := &Datasource{
+		uid:                settings.UID,
+		connectionSettings: connectionSettings,
+		authMethod:         datasourceSettings.AuthenticationMethod,
+		authenticator:      authenticator,
+		tlsConfig:          tlsConfig,
+		proxy:              proxy,
+		logSql:             datasourceSettings.LogSql,
+		queryAttribution:   datasourceSettings.QueryAttribution,
+		sessionParameters:  datasourceSettings.SessionParameters,
+		defaultCatalog:     datasourceSettings.DefaultCatalog,
+		defaultSchema:      datasourceSettings.DefaultSchema,
+		hostname:           datasourceSettings.Hostname,
+		port:               port,
+		admission:          newAdmissionController(connectionSettings.MaxConcurrent, connectionSettings.MaxQueued, connectionSettings.QueueTimeout),
+		endpointStrategy:   datasourceSettings.PathStrategy,
+		warehouses:         datasourceSettings.Warehouses,
+		warehouseEndpoints: map[string]*endpoint{},
+		demoMode:           datasourceSettings.DemoMode,
+		fixtures:           fixtures,
+	}
 
-		SetDatasourceSettings(databricksDB, connectionSettings)
-		log.DefaultLogger.Info("Store Databricks SQL DB Connection")
-		return &Datasource{
-			connector:          connector,
-			databricksDB:       databricksDB,
-			connectionSettings: connectionSettings,
-			authMethod:         datasourceSettings.AuthenticationMethod,
-		}, nil
-	case "dsn", "":
-		connector, err := dbsql.NewConnector(
-			dbsql.WithAccessToken(settings.DecryptedSecureJSONData["token"]),
+	// Every HTTP path gets its own connector and pool, every pooled session starts in the same namespace
+	// with the same session parameters
+	datasource.newConnector = func(path string) (driver.Connector, error) {
+		transport, err := newHTTPTransport(tlsConfig, proxy)
+		if err != nil {
+			return nil, err
+		}
+		return dbsql.NewConnector(
 			dbsql.WithServerHostname(datasourceSettings.Hostname),
+			dbsql.WithHTTPPath(path),
 			dbsql.WithPort(port),
-			dbsql.WithHTTPPath(datasourceSettings.Path),
+			dbsql.WithAuthenticator(authenticator),
 			dbsql.WithTimeout(connectionSettings.Timeout),
 			dbsql.WithMaxRows(connectionSettings.MaxRows),
 			dbsql.WithRetries(connectionSettings.Retries, connectionSettings.RetryBackoff, connectionSettings.MaxRetryDuration),
+			dbsql.WithInitialNamespace(datasourceSettings.DefaultCatalog, datasourceSettings.DefaultSchema),
+			dbsql.WithSessionParams(datasourceSettings.SessionParameters),
+			dbsql.WithTransport(&retryAfterTransport{
+				base:    transport,
+				uid:     settings.UID,
+				maxWait: connectionSettings.MaxRetryDuration,
+			}),
+			dbsql.WithCloudFetch(cloudFetchSupported(tlsConfig, proxy)),
 		)
+	}
+
+	log.DefaultLogger.Info("Init Databricks SQL DB")
+	for _, path := range parsePaths(datasourceSettings.Path, datasourceSettings.AdditionalPaths) {
+		connector, err := datasource.newConnector(path)
 		if err != nil {
-			log.DefaultLogger.Info("Connector Error", "err", err)
+			log.DefaultLogger.Info("Connector Error", "path", path, "err", err)
+			datasource.Dispose()
 			return nil, err
 		}
-		log.DefaultLogger.Info("Init Databricks SQL DB")
-		databricksDB := sql.OpenDB(connector)
+		datasource.endpoints = append(datasource.endpoints, newEndpoint(datasource, path, connector))
+	}
+	log.DefaultLogger.Info("Store Databricks SQL DB Connection", "paths", len(datasource.endpoints))
 
-		if err := databricksDB.Ping(); err != nil {
-			log.DefaultLogger.Info("Ping Error (Could not ping Databricks)", "err", err)
-			return nil, err
-		}
+	pools.register(datasource.uid, datasource)
 
-		SetDatasourceSettings(databricksDB, connectionSettings)
-		log.DefaultLogger.Info("Store Databricks SQL DB Connection")
-		return &Datasource{
-			connector:          connector,
-			databricksDB:       databricksDB,
-			connectionSettings: connectionSettings,
-			authMethod:         datasourceSettings.AuthenticationMethod,
-		}, nil
+	// The connection is established in the background, a stopped warehouse must not block
+	// or fail the creation of the datasource instance.
+	datasource.startWarmUp()
+	return datasource, nil
+}
+
+var sessionParameterKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+// validateSessionParameters checks that the session parameters can be set safely. The driver sets them with
+// "SET `key` = `value`" on every new session.
+func validateSessionParameters(params map[string]string) error {
+	for key, value := range params {
+		if !sessionParameterKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid session parameter name %q", key)
+		}
+		if strings.Contains(value, "`") {
+			return fmt.Errorf("invalid value for session parameter %s: must not contain backticks", key)
+		}
 	}
+	return nil
+}
 
-	log.DefaultLogger.Info("Invalid Authentication Method", "err", nil)
-	return nil, fmt.Errorf("invalid authentication method: %s", datasourceSettings.AuthenticationMethod)
+// sessionParameter returns the configured value of a session parameter (case-insensitive).
+func (d *Datasource) sessionParameter(name string) (string, bool) {
+	for key, value := range d.sessionParameters {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return "", false
 }
 
 // parseInt is a helper function to parse an integer from a string
@@ -238,6 +518,11 @@ func parseConnectionSettings(settingsRawJson json.RawMessage) ConnectionSettings
 		MaxRetryDuration: 30 * time.Second,
 		Timeout:          0 * time.Second,
 		MaxRows:          10000,
+		MaxConcurrent:    0,
+		MaxQueued:        100,
+		QueueTimeout:     30 * time.Second,
+		BreakerThreshold: 5,
+		BreakerTimeout:   30 * time.Second,
 	}
 
 	connectionSettingsJson := new(ConnectionSettingsRawJson)
@@ -251,6 +536,13 @@ func parseConnectionSettings(settingsRawJson json.RawMessage) ConnectionSettings
 	connectionSettings.MaxIdleConns = parseInt(connectionSettingsJson.MaxIdleConns, 2)
 	connectionSettings.ConnMaxLifetime = time.Duration(parseInt(connectionSettingsJson.ConnMaxLifetime, 6*3600)) * time.Second
 	connectionSettings.ConnMaxIdleTime = time.Duration(parseInt(connectionSettingsJson.ConnMaxIdleTime, 6*3600)) * time.Second
+	connectionSettings.MaxQueryTimeout = time.Duration(parseInt(connectionSettingsJson.MaxQueryTimeout, 0)) * time.Second
+	connectionSettings.MaxQueryRows = parseInt(connectionSettingsJson.MaxQueryRows, 0)
+	connectionSettings.MaxConcurrent = parseInt(connectionSettingsJson.MaxConcurrent, 0)
+	connectionSettings.MaxQueued = parseInt(connectionSettingsJson.MaxQueued, 100)
+	connectionSettings.QueueTimeout = time.Duration(parseInt(connectionSettingsJson.QueueTimeout, 30)) * time.Second
+	connectionSettings.BreakerThreshold = parseInt(connectionSettingsJson.BreakerThreshold, 5)
+	connectionSettings.BreakerTimeout = time.Duration(parseInt(connectionSettingsJson.BreakerTimeout, 30)) * time.Second
 
 	return connectionSettings
 }
@@ -263,65 +555,98 @@ func SetDatasourceSettings(db *sql.DB, connectionSettings ConnectionSettings) {
 	db.SetMaxOpenConns(connectionSettings.MaxOpenConns)
 }
 
-// RefreshDBConnection is a helper function which initializes a new DB connection
-func (d *Datasource) RefreshDBConnection() error {
-	d.databricksDB = sql.OpenDB(d.connector)
-
-	if err := d.databricksDB.Ping(); err != nil {
-		log.DefaultLogger.Info("Ping Error (Could not ping Databricks)", "err", err)
-		return err
-	}
+// sqlExecutor is implemented by both the connection pool (*sql.DB) and a dedicated connection (*sql.Conn).
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
 
-	SetDatasourceSettings(d.databricksDB, d.connectionSettings)
-	log.DefaultLogger.Info("Store Databricks SQL DB Connection")
-	return nil
+// isInvalidSession returns true if the error was caused by an expired Databricks session.
+func isInvalidSession(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Invalid SessionHandle")
 }
 
 // ExecContext is a helper function to execute a query on the Databricks SQL DB without returning any rows and handling session expiration
 func (d *Datasource) ExecContext(ctx context.Context, queryString string) error {
-	_, err := d.databricksDB.ExecContext(ctx, queryString)
+	candidates := d.candidates()
+	if err := checkCircuits(ctx, candidates); err != nil {
+		return err
+	}
+	release, err := d.admission.acquire(ctx)
 	if err != nil {
-		if strings.Contains(err.Error(), "Invalid SessionHandle") {
-			err = d.RefreshDBConnection()
-			if err != nil {
-				return err
-			}
-			return d.ExecContext(ctx, queryString)
-		}
 		return err
 	}
-	return nil
+	defer release()
+
+	return d.withEndpoint(ctx, candidates, func(e *endpoint) error {
+		return e.execContext(ctx, queryString)
+	})
 }
 
-// QueryContext is a helper function to query the Databricks SQL DB returning the rows and handling session expiration
+// QueryContext is a helper function to query the Databricks SQL DB returning the rows and handling session expiration.
+// The admission slot is held while the statement executes, fetching the rows afterwards isn't limited.
 func (d *Datasource) QueryContext(ctx context.Context, queryString string) (*sql.Rows, error) {
-	rows, err := d.databricksDB.QueryContext(ctx, queryString)
+	candidates := d.candidates()
+	if err := checkCircuits(ctx, candidates); err != nil {
+		return nil, err
+	}
+	release, err := d.admission.acquire(ctx)
 	if err != nil {
-		if strings.Contains(err.Error(), "Invalid SessionHandle") {
-			err = d.RefreshDBConnection()
-			if err != nil {
-				return nil, err
-			}
-			return d.QueryContext(ctx, queryString)
-		}
 		return nil, err
 	}
-	return rows, nil
+	defer release()
+
+	var rows *sql.Rows
+	err = d.withEndpoint(ctx, candidates, func(e *endpoint) error {
+		rows, err = e.queryContext(ctx, queryString)
+		return err
+	})
+	return rows, err
 }
 
+var errReplayMode = errors.New("datasource is in replay mode and not connected to Databricks")
+
 // Datasource is an example datasource which can respond to data queries, reports
 // its health and has streaming skills.
 type Datasource struct {
-	connector          driver.Connector
-	databricksDB       *sql.DB
+	uid                string
+	endpoints          []*endpoint
+	endpointStrategy   string
+	roundRobin         atomic.Uint64
+	newConnector       func(path string) (driver.Connector, error)
+	warehouses         map[string]string
+	warehouseMu        sync.Mutex
+	warehouseEndpoints map[string]*endpoint
 	connectionSettings ConnectionSettings
 	authMethod         string
+	authenticator      auth.Authenticator
+	tlsConfig          *tls.Config
+	proxy              *proxySettings
+	hostname           string
+	port               int
+	logSql             bool
+	queryAttribution   bool
+	sessionParameters  map[string]string
+	// defaultCatalog and defaultSchema are the namespace every pooled session starts in
+	defaultCatalog string
+	defaultSchema  string
+	// queryTagsUnsupported is set once the warehouse rejected setting query tags
+	queryTagsUnsupported atomic.Bool
+	admission            *admissionController
+	cancelWarmUp         context.CancelFunc
+	demoMode             string
+	fixtures             *fixtureStore
 }
 
 // CallResource handles resource calls sent from Grafana to the plugin.
 func (d *Datasource) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
 	ctx = AddPassTroughTokenToContext(ctx, req.GetHTTPHeader(backend.OAuthIdentityTokenHeaderName))
-	return autocompletionQueries(ctx, req, sender, d)
+	ctx = AddPassTroughIDTokenToContext(ctx, req.GetHTTPHeader(backend.OAuthIdentityIDTokenHeaderName))
+
+	start := time.Now()
+	err := autocompletionQueries(ctx, req, sender, d)
+	observeQueryDuration(d.uid, queryKindResource, outcomeFromError(err), start)
+	return err
 }
 
 // Dispose here tells plugin SDK that plugin wants to clean up resources when a new instance
@@ -329,11 +654,12 @@ func (d *Datasource) CallResource(ctx context.Context, req *backend.CallResource
 // be disposed and a new one will be created using NewSampleDatasource factory function.
 func (d *Datasource) Dispose() {
 	// Clean up datasource instance resources.
-	if d.databricksDB != nil {
-		err := d.databricksDB.Close()
-		if err != nil {
-			log.DefaultLogger.Error("Error closing DB connection", "err", err)
-		}
+	if d.cancelWarmUp != nil {
+		d.cancelWarmUp()
+	}
+	pools.unregister(d.uid, d)
+	for _, e := range d.allEndpoints() {
+		e.close()
 	}
 }
 
@@ -342,16 +668,26 @@ func (d *Datasource) Dispose() {
 // The QueryDataResponse contains a map of RefID to the response for each query, and each response
 // contains Frames ([]*Frame).
 func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
-	log.DefaultLogger.Info("QueryData called", "request", req)
+	log.DefaultLogger.FromContext(ctx).Debug("QueryData called", "queries", len(req.Queries), "headers", redactHeaders(req.Headers))
 
 	ctx = AddPassTroughTokenToContext(ctx, req.GetHTTPHeader(backend.OAuthIdentityTokenHeaderName))
+	ctx = AddPassTroughIDTokenToContext(ctx, req.GetHTTPHeader(backend.OAuthIdentityIDTokenHeaderName))
+	ctx = withRequestInfo(ctx, newRequestInfo(req.PluginContext, req.Headers))
+
+	ctx, span := startSpan(ctx, "databricks.QueryData",
+		attributeDatasourceUID.String(d.uid),
+		attributeQueries.Int(len(req.Queries)),
+	)
+	defer span.End()
 
 	// create response struct
 	response := backend.NewQueryDataResponse()
 
 	// loop over queries and execute them individually.
 	for _, q := range req.Queries {
+		start := time.Now()
 		res := d.query(ctx, req.PluginContext, q)
+		observeQueryDuration(d.uid, queryKindData, outcomeFromError(res.Error), start)
 
 		// save the response in a hashmap
 		// based on with RefID as identifier
@@ -368,82 +704,128 @@ type querySettings struct {
 }
 
 type queryModel struct {
-	RawSql        string        `json:"rawSql"`
+	RawSql  string `json:"rawSql"`
+	Catalog string `json:"catalog"`
+	Schema  string `json:"schema"`
+	// Warehouse selects a SQL warehouse of the allowlist of the datasource by name
+	Warehouse string `json:"warehouse"`
+	// Timeout in seconds and MaxRows override the datasource defaults for a single query (0 = default)
+	Timeout       int           `json:"timeout"`
+	MaxRows       int           `json:"maxRows"`
 	QuerySettings querySettings `json:"querySettings"`
 }
 
 // query executes a query and returns the response.
-func (d *Datasource) query(ctx context.Context, pCtx backend.PluginContext, query backend.DataQuery) backend.DataResponse {
-	response := backend.DataResponse{}
+func (d *Datasource) query(ctx context.Context, pCtx backend.PluginContext, query backend.DataQuery) (response backend.DataResponse) {
+	ctx, span := startSpan(ctx, "databricks.query", attributeRefID.String(query.RefID))
+	defer func() { endSpan(span, response.Error) }()
+
+	ctx = withQueryLogAttributes(ctx, pCtx, query.RefID)
+	logger := loggerFromContext(ctx)
+	start := time.Now()
+	defer func() {
+		logger.Debug("Query completed", "duration", time.Since(start).String(), "err", response.Error)
+	}()
 
 	// Unmarshal the JSON into our queryModel.
 	var qm queryModel
 
-	log.DefaultLogger.Info("Query Full", "query", query)
 	err := json.Unmarshal(query.JSON, &qm)
 	if err != nil {
-		response.Error = err
-		log.DefaultLogger.Info("Query Parsing Error", "err", err)
+		logger.Debug("Query Parsing Error", "err", err)
+		return errorResponse(err, "")
+	}
+
+	if d.demoMode == demoModeReplay {
+		frames, err := d.fixtures.replay(qm, query)
+		if err != nil {
+			logger.Debug("Replay Error", "err", err)
+			return errorResponse(err, qm.RawSql)
+		}
+		response.Frames = frames
 		return response
 	}
 
-	queryString := replaceMacros(qm.RawSql, query)
+	macroCtx, macroSpan := startSpan(ctx, "databricks.replaceMacros")
+	queryString := replaceMacros(macroCtx, qm.RawSql, query)
+	endSpan(macroSpan, nil)
 
 	// Check if the query string is empty
 	if strings.TrimSpace(queryString) == "" {
-		response.Error = fmt.Errorf("query string is empty")
-		log.DefaultLogger.Info("Query String Empty", "err", response.Error)
-		return response
+		err := newQueryError(errorCategorySyntax, fmt.Errorf("query string is empty"))
+		logger.Debug("Query String Empty", "err", err)
+		return errorResponse(err, queryString)
+	}
+
+	timeout, rowLimit := d.queryLimits(qm)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	// Check if multiple statements are present in the query
-	// If so, split them and execute them individually
-	if strings.Contains(queryString, ";") {
-		// Split the query string into multiple statements
-		queries := strings.Split(queryString, ";")
-		// Check if the last statement is empty or just whitespace and newlines
-		if strings.TrimSpace(queries[len(queries)-1]) == "" {
-			// Remove the last statement
-			queries = queries[:len(queries)-1]
-		}
-		// Check if there are stil multiple statements
-		if len(queries) > 1 {
-			// Execute all but the last statement without returning any data
-			for _, query := range queries[:len(queries)-1] {
-				err := d.ExecContext(ctx, query)
-				if err != nil {
-					response.Error = err
-					log.DefaultLogger.Info("Error", "err", err)
-					return response
-				}
-			}
-			// Set the query string to the last statement
-			queryString = queries[len(queries)-1]
+	// If so, execute all but the last statement without returning any data
+	_, splitSpan := startSpan(ctx, "databricks.splitStatements")
+	statements, queryString := splitStatements(queryString)
+	splitSpan.SetAttributes(attributeStatements.Int(len(statements) + 1))
+	endSpan(splitSpan, nil)
+
+	// All statements of the query run on the same connection, so session settings of the
+	// query apply to all of them and don't leak into other queries.
+	var rows *sql.Rows
+	failedStatement := queryString
+	session, err := d.openSession(ctx, qm.Warehouse, func(session *querySession) error {
+		failedStatement = queryString
+		if d.queryAttribution {
+			session.applyAttribution(ctx, requestInfoFromContext(ctx))
 		}
-	}
 
-	log.DefaultLogger.Info("Query", "query", queryString)
+		if err := session.useNamespace(ctx, qm.Catalog, qm.Schema); err != nil {
+			return err
+		}
 
-	frame := data.NewFrame("response")
+		if err := session.setStatementTimeout(ctx, timeout); err != nil {
+			return err
+		}
+
+		for _, statement := range statements {
+			if err := session.ExecContext(ctx, statement); err != nil {
+				failedStatement = statement
+				return err
+			}
+		}
 
-	rows, err := d.QueryContext(ctx, queryString)
+		var err error
+		rows, err = session.QueryContext(ctx, queryString)
+		return err
+	})
 	if err != nil {
-		response.Error = err
-		log.DefaultLogger.Info("Error", "err", err)
-		return response
+		return errorResponse(err, failedStatement)
 	}
+	defer session.Close(ctx)
+	defer rows.Close()
+
+	frame := data.NewFrame("response")
 
-	frame, err = sqlutil.FrameFromRows(rows, -1)
+	_, frameSpan := startSpan(ctx, "databricks.FrameFromRows")
+	frame, err = sqlutil.FrameFromRows(rows, rowLimit)
 	if err != nil {
-		log.DefaultLogger.Info("FrameFromRows", "err", err)
-		response.Error = err
-		return response
+		endSpan(frameSpan, err)
+		logger.Debug("FrameFromRows", "err", err)
+		return errorResponse(err, queryString)
 	}
+	rowCount, _ := frame.RowLen()
+	frameSpan.SetAttributes(attributeRows.Int(rowCount))
+	endSpan(frameSpan, nil)
+	span.SetAttributes(attributeRows.Int(rowCount))
 
 	if qm.QuerySettings.ConvertLongToWide {
+		_, wideSpan := startSpan(ctx, "databricks.LongToWide")
 		wideFrame, err := data.LongToWide(frame, &data.FillMissing{Value: qm.QuerySettings.FillValue, Mode: qm.QuerySettings.FillMode})
+		endSpan(wideSpan, err)
 		if err != nil {
-			log.DefaultLogger.Info("LongToWide conversion error", "err", err)
+			logger.Info("LongToWide conversion error", "err", err)
 		} else {
 			frame = wideFrame
 		}
@@ -451,6 +833,13 @@ func (d *Datasource) query(ctx context.Context, pCtx backend.PluginContext, quer
 
 	// add the frames to the response.
 	response.Frames = append(response.Frames, frame)
+	observeFrame(d.uid, frame)
+
+	if d.demoMode == demoModeRecord {
+		if err := d.fixtures.record(qm, query, response.Frames); err != nil {
+			logger.Warn("Failed to record query fixture", "err", err)
+		}
+	}
 
 	return response
 }
@@ -460,27 +849,40 @@ func AddPassTroughTokenToContext(ctx context.Context, token string) context.Cont
 	return context.WithValue(ctx, "pass_through_oauth_token", token)
 }
 
+// AddPassTroughIDTokenToContext adds the pass through ID token to the context, used by the token exchange
+func AddPassTroughIDTokenToContext(ctx context.Context, idToken string) context.Context {
+	return context.WithValue(ctx, "pass_through_id_token", idToken)
+}
+
 // CheckHealth handles health checks sent from Grafana to the plugin.
 // The main use case for these health checks is the test button on the
 // datasource configuration page which allows users to verify that
 // a datasource is working as expected.
 func (d *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
-	log.DefaultLogger.Info("CheckHealth called", "request", req)
+	log.DefaultLogger.FromContext(ctx).Debug("CheckHealth called", "headers", redactHeaders(req.Headers))
 	ctx = AddPassTroughTokenToContext(ctx, req.GetHTTPHeader(backend.OAuthIdentityTokenHeaderName))
+	ctx = AddPassTroughIDTokenToContext(ctx, req.GetHTTPHeader(backend.OAuthIdentityIDTokenHeaderName))
 
-	rows, err := d.QueryContext(ctx, "SELECT 1")
-
-	if err != nil {
+	if d.demoMode == demoModeReplay {
+		count, err := d.fixtures.count()
+		if err != nil {
+			return &backend.CheckHealthResult{
+				Status:  backend.HealthStatusError,
+				Message: fmt.Sprintf("Fixture directory could not be read: %s", err),
+			}, nil
+		}
 		return &backend.CheckHealthResult{
-			Status:  backend.HealthStatusError,
-			Message: fmt.Sprintf("SQL Connection Failed: %s", err),
+			Status:  backend.HealthStatusOk,
+			Message: fmt.Sprintf("Replay mode: serving %d recorded queries", count),
 		}, nil
 	}
 
-	defer rows.Close()
-
-	return &backend.CheckHealthResult{
-		Status:  backend.HealthStatusOk,
-		Message: "Data source is working",
-	}, nil
+	start := time.Now()
+	result := d.runHealthDiagnostics(ctx)
+	outcome := outcomeSuccess
+	if result.Status != backend.HealthStatusOk {
+		outcome = outcomeError
+	}
+	observeQueryDuration(d.uid, queryKindHealth, outcome, start)
+	return result, nil
 }
@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
+	"golang.org/x/net/http/httpproxy"
+	"net/http"
+	"net/url"
+)
+
+// proxySettings route the connections of the datasource through an explicit HTTP(S) or SOCKS5 proxy, or
+// through the secure SOCKS proxy of Grafana (private data source connect). Without an explicit proxy the
+// proxy environment variables apply.
+type proxySettings struct {
+	proxyURL func(*http.Request) (*url.URL, error)
+	// explicit is true if the datasource configures a proxy, instead of the proxy environment variables
+	explicit    bool
+	secureSocks proxy.Client
+}
+
+func newProxySettings(ctx context.Context, instanceSettings backend.DataSourceInstanceSettings, settings *DatasourceSettings) (*proxySettings, error) {
+	p := &proxySettings{proxyURL: http.ProxyFromEnvironment}
+
+	if settings.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(settings.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		switch proxyUrl.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid proxy url: scheme must be http, https or socks5")
+		}
+		if proxyUrl.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url: host is missing")
+		}
+		if settings.ProxyUsername != "" {
+			proxyUrl.User = url.UserPassword(settings.ProxyUsername, instanceSettings.DecryptedSecureJSONData["proxyPassword"])
+		}
+		proxyFunc := (&httpproxy.Config{
+			HTTPProxy:  proxyUrl.String(),
+			HTTPSProxy: proxyUrl.String(),
+			NoProxy:    settings.NoProxy,
+		}).ProxyFunc()
+		p.proxyURL = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+		p.explicit = true
+	}
+
+	options, err := instanceSettings.ProxyOptionsFromContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("secure socks proxy options could not be read: %w", err)
+	}
+	if options != nil {
+		// The SDK reads the dial timeout from the timeout setting, which is the query timeout of this datasource
+		options.Timeouts = &proxy.DefaultTimeoutOptions
+		p.secureSocks = proxy.New(options)
+		if p.secureSocks.SecureSocksProxyEnabled() {
+			log.DefaultLogger.Info("Using secure socks proxy", "datasource", instanceSettings.Name)
+		} else {
+			log.DefaultLogger.Warn("Secure socks proxy is enabled on the datasource, but not configured in Grafana", "datasource", instanceSettings.Name)
+		}
+	}
+	return p, nil
+}
+
+// configure applies the proxy to transport. The secure socks proxy replaces any other proxy.
+func (p *proxySettings) configure(transport *http.Transport) error {
+	if p == nil {
+		return nil
+	}
+	if p.secureSocksEnabled() {
+		transport.Proxy = nil
+		return p.secureSocks.ConfigureSecureSocksHTTPProxy(transport)
+	}
+	transport.Proxy = p.proxyURL
+	return nil
+}
+
+// customized returns true if the datasource routes its connections differently than the default HTTP client.
+func (p *proxySettings) customized() bool {
+	return p != nil && (p.explicit || p.secureSocksEnabled())
+}
+
+func (p *proxySettings) secureSocksEnabled() bool {
+	return p != nil && p.secureSocks != nil && p.secureSocks.SecureSocksProxyEnabled()
+}
+
+// usedFor returns true if the connections to hostname go through a proxy.
+func (p *proxySettings) usedFor(hostname string) bool {
+	if p == nil {
+		return false
+	}
+	if p.secureSocksEnabled() {
+		return true
+	}
+	proxyUrl, err := p.proxyURL(&http.Request{URL: &url.URL{Scheme: "https", Host: hostname}})
+	return err == nil && proxyUrl != nil
+}
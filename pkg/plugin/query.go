@@ -1,9 +1,9 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
-	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"regexp"
 	"strings"
 	"time"
@@ -29,29 +29,30 @@ func getIntervalString(duration time.Duration) string {
 	return strings.Join(parts, " ")
 }
 
-func replaceMacros(sqlQuery string, query backend.DataQuery) string {
+func replaceMacros(ctx context.Context, sqlQuery string, query backend.DataQuery) string {
 
+	logger := loggerFromContext(ctx)
 	queryString := sqlQuery
-	log.DefaultLogger.Info("Raw SQL Query selected", "query", queryString)
+	logger.Debug("Raw SQL Query selected")
 
 	interval_string := getIntervalString(query.Interval)
 
 	var rgx = regexp.MustCompile(`\$__timeWindow\(([a-zA-Z0-9_-]+)\)`)
 	if rgx.MatchString(queryString) {
-		log.DefaultLogger.Info("__timeWindow placeholder found")
+		logger.Debug("__timeWindow placeholder found")
 		rs := rgx.FindStringSubmatch(queryString)
 		timeColumnName := rs[1]
 		queryString = rgx.ReplaceAllString(queryString, fmt.Sprintf("window(%s, '%s')", timeColumnName, interval_string))
 
 		rgx = regexp.MustCompile(`\$__time\(([a-zA-Z0-9_-]+)\)`)
 		if rgx.MatchString(queryString) {
-			log.DefaultLogger.Info("__time placeholder found")
+			logger.Debug("__time placeholder found")
 			queryString = rgx.ReplaceAllString(queryString, "window.start")
 		}
 
 		rgx = regexp.MustCompile(`\$__value\(([a-zA-Z0-9_-]+)\)`)
 		if rgx.MatchString(queryString) {
-			log.DefaultLogger.Info("__value placeholder found")
+			logger.Debug("__value placeholder found")
 			rs = rgx.FindStringSubmatch(queryString)
 			valueColumnName := rs[1]
 			queryString = rgx.ReplaceAllString(queryString, fmt.Sprintf("avg(%s) AS value", valueColumnName))
@@ -59,7 +60,7 @@ func replaceMacros(sqlQuery string, query backend.DataQuery) string {
 	} else {
 		rgx = regexp.MustCompile(`\$__time\(([a-zA-Z0-9_-]+)\)`)
 		if rgx.MatchString(queryString) {
-			log.DefaultLogger.Info("__time placeholder found")
+			logger.Debug("__time placeholder found")
 			rs := rgx.FindStringSubmatch(queryString)
 			timeColumnName := rs[1]
 			queryString = rgx.ReplaceAllString(queryString, fmt.Sprintf("%s AS time", timeColumnName))
@@ -67,7 +68,7 @@ func replaceMacros(sqlQuery string, query backend.DataQuery) string {
 
 		rgx = regexp.MustCompile(`\$__value\(([a-zA-Z0-9_-]+)\)`)
 		if rgx.MatchString(queryString) {
-			log.DefaultLogger.Info("__value placeholder found")
+			logger.Debug("__value placeholder found")
 			rs := rgx.FindStringSubmatch(queryString)
 			valueColumnName := rs[1]
 			queryString = rgx.ReplaceAllString(queryString, fmt.Sprintf("%s AS value", valueColumnName))
@@ -139,3 +140,23 @@ func replaceMacros(sqlQuery string, query backend.DataQuery) string {
 
 	return queryString
 }
+
+// splitStatements splits a query string with multiple statements into the statements which are executed
+// without returning any data and the last statement, which returns the data of the query.
+func splitStatements(queryString string) ([]string, string) {
+	if !strings.Contains(queryString, ";") {
+		return nil, queryString
+	}
+
+	statements := strings.Split(queryString, ";")
+	// Check if the last statement is empty or just whitespace and newlines
+	if strings.TrimSpace(statements[len(statements)-1]) == "" {
+		// Remove the last statement
+		statements = statements[:len(statements)-1]
+	}
+	if len(statements) < 2 {
+		return nil, queryString
+	}
+
+	return statements[:len(statements)-1], statements[len(statements)-1]
+}
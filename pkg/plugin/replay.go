@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	demoModeRecord = "record"
+	demoModeReplay = "replay"
+)
+
+type fixtureTimeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// queryFixture is the on-disk representation of a recorded query response.
+type queryFixture struct {
+	Sql        string           `json:"sql"`
+	RecordedAt time.Time        `json:"recordedAt"`
+	TimeRange  fixtureTimeRange `json:"timeRange"`
+	Frames     data.Frames      `json:"frames"`
+}
+
+// fixtureKey holds everything a recorded response depends on. The SQL is the normalized raw SQL (before
+// macro expansion). With time shifting only the length of the time range is part of the key, so a recorded
+// query can be replayed for any dashboard time range of the same length.
+type fixtureKey struct {
+	Sql           string           `json:"sql"`
+	Catalog       string           `json:"catalog,omitempty"`
+	Schema        string           `json:"schema,omitempty"`
+	Warehouse     string           `json:"warehouse,omitempty"`
+	MaxRows       int              `json:"maxRows,omitempty"`
+	QuerySettings querySettings    `json:"querySettings"`
+	TimeRange     fixtureTimeRange `json:"timeRange"`
+	Range         time.Duration    `json:"range,omitempty"`
+}
+
+// fixtureStore records query responses to and replays them from a local directory.
+type fixtureStore struct {
+	dir       string
+	timeShift bool
+}
+
+func newFixtureStore(dir string, timeShift bool) *fixtureStore {
+	return &fixtureStore{
+		dir:       dir,
+		timeShift: timeShift,
+	}
+}
+
+// normalizeSql collapses whitespace and strips trailing semicolons, so that formatting
+// changes in the query editor don't invalidate recorded fixtures.
+func normalizeSql(sql string) string {
+	normalized := strings.Join(strings.Fields(sql), " ")
+	return strings.TrimRight(normalized, "; ")
+}
+
+// fixturePath returns the path of the fixture of a query, named by the hash of its fixture key.
+func (s *fixtureStore) fixturePath(qm queryModel, query backend.DataQuery) (string, error) {
+	key := fixtureKey{
+		Sql:           normalizeSql(qm.RawSql),
+		Catalog:       qm.Catalog,
+		Schema:        qm.Schema,
+		Warehouse:     qm.Warehouse,
+		MaxRows:       qm.MaxRows,
+		QuerySettings: qm.QuerySettings,
+	}
+	if s.timeShift {
+		key.Range = query.TimeRange.To.Sub(query.TimeRange.From)
+	} else {
+		key.TimeRange = fixtureTimeRange{From: query.TimeRange.From.UTC(), To: query.TimeRange.To.UTC()}
+	}
+	body, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(body)
+	return filepath.Join(s.dir, hex.EncodeToString(hash[:16])+".json"), nil
+}
+
+// record writes the frames returned for the given query to the fixture directory.
+func (s *fixtureStore) record(qm queryModel, query backend.DataQuery, frames data.Frames) error {
+	path, err := s.fixturePath(qm, query)
+	if err != nil {
+		return err
+	}
+	fixture := &queryFixture{
+		Sql:        normalizeSql(qm.RawSql),
+		RecordedAt: time.Now().UTC(),
+		TimeRange: fixtureTimeRange{
+			From: query.TimeRange.From.UTC(),
+			To:   query.TimeRange.To.UTC(),
+		},
+		Frames: frames,
+	}
+
+	body, err := json.Marshal(fixture)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so concurrent replays never read a partial fixture
+	tmp, err := os.CreateTemp(s.dir, ".fixture-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// replay loads the recorded frames for the given query. If time shifting is enabled,
+// all time values are moved by the offset between the recorded and the requested time range end.
+func (s *fixtureStore) replay(qm queryModel, query backend.DataQuery) (data.Frames, error) {
+	path, err := s.fixturePath(qm, query)
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no recorded fixture found for query")
+		}
+		return nil, err
+	}
+
+	fixture := new(queryFixture)
+	if err := json.Unmarshal(body, fixture); err != nil {
+		return nil, fmt.Errorf("fixture could not be parsed: %w", err)
+	}
+
+	if s.timeShift && !query.TimeRange.To.IsZero() && !fixture.TimeRange.To.IsZero() {
+		shiftFrames(fixture.Frames, query.TimeRange.To.Sub(fixture.TimeRange.To))
+	}
+
+	return fixture.Frames, nil
+}
+
+// count returns the number of fixtures available in the fixture directory.
+func (s *fixtureStore) count() (int, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	return len(matches), nil
+}
+
+// shiftFrames moves all time values of the given frames by offset.
+func shiftFrames(frames data.Frames, offset time.Duration) {
+	for _, frame := range frames {
+		for _, field := range frame.Fields {
+			switch field.Type() {
+			case data.FieldTypeTime:
+				for i := 0; i < field.Len(); i++ {
+					field.Set(i, field.At(i).(time.Time).Add(offset))
+				}
+			case data.FieldTypeNullableTime:
+				for i := 0; i < field.Len(); i++ {
+					if t := field.At(i).(*time.Time); t != nil {
+						shifted := t.Add(offset)
+						field.Set(i, &shifted)
+					}
+				}
+			}
+		}
+	}
+}
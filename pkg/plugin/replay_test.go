@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"testing"
+	"time"
+)
+
+func TestFixtureKey(t *testing.T) {
+	now := time.Now()
+	recorded := queryModel{RawSql: "SELECT * FROM sales;", Catalog: "main", Schema: "default", Warehouse: "small", MaxRows: 100}
+	recordedQuery := backend.DataQuery{TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now}}
+	later := backend.DataQuery{TimeRange: backend.TimeRange{From: now, To: now.Add(time.Hour)}}
+	longer := backend.DataQuery{TimeRange: backend.TimeRange{From: now.Add(-2 * time.Hour), To: now}}
+
+	with := func(change func(qm *queryModel)) queryModel {
+		qm := recorded
+		change(&qm)
+		return qm
+	}
+	tests := []struct {
+		name      string
+		timeShift bool
+		qm        queryModel
+		query     backend.DataQuery
+		found     bool
+	}{
+		{"same query", false, with(func(qm *queryModel) { qm.RawSql = "SELECT *\n  FROM sales" }), recordedQuery, true},
+		{"other catalog", false, with(func(qm *queryModel) { qm.Catalog = "dev" }), recordedQuery, false},
+		{"other schema", false, with(func(qm *queryModel) { qm.Schema = "finance" }), recordedQuery, false},
+		{"other warehouse", false, with(func(qm *queryModel) { qm.Warehouse = "large" }), recordedQuery, false},
+		{"other row limit", false, with(func(qm *queryModel) { qm.MaxRows = 10 }), recordedQuery, false},
+		{"other query settings", false, with(func(qm *queryModel) { qm.QuerySettings.ConvertLongToWide = true }), recordedQuery, false},
+		{"other time range", false, recorded, later, false},
+		{"shifted time range", true, recorded, later, true},
+		{"longer time range", true, recorded, longer, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFixtureStore(t.TempDir(), tt.timeShift)
+			frames := data.Frames{data.NewFrame("response", data.NewField("value", nil, []float64{1}))}
+			if err := store.record(recorded, recordedQuery, frames); err != nil {
+				t.Fatal(err)
+			}
+			_, err := store.replay(tt.qm, tt.query)
+			if (err == nil) != tt.found {
+				t.Errorf("expected fixture found=%t, got %v", tt.found, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"time"
+)
+
+// restoreTimeout bounds restoring the session settings, which also runs if the query context was cancelled.
+const restoreTimeout = 30 * time.Second
+
+type sessionSetting struct {
+	statement string
+	restore   string
+}
+
+// querySession pins all statements of a single query to one pooled connection, so session level settings
+// apply to the query only and are restored before the connection is returned to the pool.
+type querySession struct {
+	d        *Datasource
+	e        *endpoint
+	conn     *sql.Conn
+	comment  string
+	settings []sessionSetting
+	// catalog and schema are the current namespace of the session, if known
+	catalog string
+	schema  string
+	// release frees the admission slot of the query
+	release func()
+}
+
+// openSession acquires a dedicated connection from the pool of an endpoint for a single query, or of the
+// named warehouse if set, and prepares it with prepare, i.e. runs the statements of the query. If prepare
+// fails with a connectivity error before any rows are returned, the session is abandoned and the whole query
+// is tried again on the next endpoint. Unless the circuits of all endpoints are open, the query is admitted
+// by the admission controller first and holds its slot until the session is closed. Errors are annotated with the connection state of the last endpoint tried.
+func (d *Datasource) openSession(ctx context.Context, warehouse string, prepare func(s *querySession) error) (*querySession, error) {
+	if len(d.endpoints) == 0 {
+		return nil, errReplayMode
+	}
+	candidates := d.candidates()
+	if warehouse != "" {
+		e, err := d.warehouseEndpoint(warehouse)
+		if err != nil {
+			return nil, err
+		}
+		candidates = []*endpoint{e}
+	}
+
+	if err := checkCircuits(ctx, candidates); err != nil {
+		return nil, err
+	}
+	release, err := d.admission.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var session *querySession
+	var last *endpoint
+	err = d.withEndpoint(ctx, candidates, func(e *endpoint) error {
+		last = e
+		conn, err := e.db.Conn(ctx)
+		e.status.observe(err)
+		if err != nil {
+			// Conn returns idle pooled connections without any request, so only a failure tells something
+			// about the warehouse. Successes are recorded by the statements of the session.
+			e.breaker.record(err)
+			return err
+		}
+		e.inFlight.Add(1)
+		// The admission slot is handed over to the session only once it is prepared
+		s := &querySession{d: d, e: e, conn: conn, release: func() {}, catalog: d.defaultCatalog, schema: d.defaultSchema}
+		if err := prepare(s); err != nil {
+			if isConnectivityFailure(err) {
+				// Settings can't be restored on an unavailable warehouse
+				s.discard()
+				e.inFlight.Add(-1)
+			} else {
+				s.Close(ctx)
+			}
+			return err
+		}
+		s.release = release
+		session = s
+		return nil
+	})
+	if err != nil {
+		release()
+		if last != nil {
+			err = last.status.annotate(err)
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// setComment sets a SQL comment which is prepended to every statement of the query.
+func (s *querySession) setComment(comment string) {
+	s.comment = comment
+}
+
+// set executes a session setting statement and remembers the statement restoring the previous state.
+func (s *querySession) set(ctx context.Context, statement string, restore string) error {
+	if err := s.exec(ctx, statement); err != nil {
+		return err
+	}
+	s.settings = append(s.settings, sessionSetting{statement: statement, restore: restore})
+	return nil
+}
+
+func (s *querySession) exec(ctx context.Context, statement string) error {
+	err := s.e.execStatement(ctx, s.conn, statement)
+	if isInvalidSession(err) {
+		if err := s.reconnect(ctx); err != nil {
+			return err
+		}
+		return s.e.execStatement(ctx, s.conn, statement)
+	}
+	return err
+}
+
+// ExecContext executes a statement of the query without returning any rows.
+func (s *querySession) ExecContext(ctx context.Context, queryString string) error {
+	return s.exec(ctx, s.comment+queryString)
+}
+
+// QueryContext executes a statement of the query returning the rows.
+func (s *querySession) QueryContext(ctx context.Context, queryString string) (*sql.Rows, error) {
+	rows, err := s.e.queryStatement(ctx, s.conn, s.comment+queryString)
+	if isInvalidSession(err) {
+		if err := s.reconnect(ctx); err != nil {
+			return nil, err
+		}
+		return s.e.queryStatement(ctx, s.conn, s.comment+queryString)
+	}
+	return rows, err
+}
+
+// reconnect replaces an expired session with a new connection and applies the session settings again.
+func (s *querySession) reconnect(ctx context.Context) error {
+	trace.SpanFromContext(ctx).AddEvent("session_refresh")
+	s.discard()
+	if err := s.e.refresh(ctx); err != nil {
+		return err
+	}
+	conn, err := s.e.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	for _, setting := range s.settings {
+		if err := s.e.execStatement(ctx, s.conn, setting.statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard closes the connection without returning it to the pool.
+func (s *querySession) discard() {
+	_ = s.conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = s.conn.Close()
+}
+
+// Close restores all session settings in reverse order and returns the connection to the pool.
+// If a setting can't be restored, the connection is discarded so no other query inherits it.
+func (s *querySession) Close(ctx context.Context) {
+	defer s.release()
+	defer s.e.inFlight.Add(-1)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+	defer cancel()
+
+	for i := len(s.settings) - 1; i >= 0; i-- {
+		if err := s.e.execStatement(ctx, s.conn, s.settings[i].restore); err != nil {
+			loggerFromContext(ctx).Warn("Session setting could not be restored, discarding connection", "err", err)
+			s.discard()
+			return
+		}
+	}
+	if err := s.conn.Close(); err != nil {
+		loggerFromContext(ctx).Debug("Error closing session connection", "err", err)
+	}
+}
+
+// quoteIdentifier quotes a catalog, schema or table name for use in a statement.
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// currentNamespace returns the current catalog and schema of the session. The namespace is only queried
+// if neither the datasource defaults nor a previous namespace switch tell it.
+func (s *querySession) currentNamespace(ctx context.Context) (string, string, error) {
+	if s.catalog != "" && s.schema != "" {
+		return s.catalog, s.schema, nil
+	}
+
+	rows, err := s.e.queryStatement(ctx, s.conn, "SELECT current_catalog(), current_schema()")
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+
+	var catalog, schema sql.NullString
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", "", err
+		}
+		return "", "", fmt.Errorf("current namespace could not be determined")
+	}
+	if err := rows.Scan(&catalog, &schema); err != nil {
+		return "", "", err
+	}
+	if catalog.String == "" {
+		return "", "", fmt.Errorf("current namespace could not be determined")
+	}
+	s.catalog, s.schema = catalog.String, schema.String
+	return s.catalog, s.schema, nil
+}
+
+// useNamespace switches the session to the given catalog and schema. The previous namespace is
+// restored when the session is closed, so the pooled connection doesn't leak the namespace of one
+// query into another.
+func (s *querySession) useNamespace(ctx context.Context, catalog string, schema string) error {
+	if catalog == "" && schema == "" {
+		return nil
+	}
+
+	currentCatalog, currentSchema, err := s.currentNamespace(ctx)
+	if err != nil {
+		return err
+	}
+	if catalog == "" {
+		catalog = currentCatalog
+	}
+	if catalog == currentCatalog && (schema == "" || schema == currentSchema) {
+		return nil
+	}
+
+	statement := fmt.Sprintf("USE CATALOG %s", quoteIdentifier(catalog))
+	if schema != "" {
+		statement = fmt.Sprintf("USE SCHEMA %s.%s", quoteIdentifier(catalog), quoteIdentifier(schema))
+	}
+	restore := fmt.Sprintf("USE CATALOG %s", quoteIdentifier(currentCatalog))
+	if currentSchema != "" {
+		restore = fmt.Sprintf("USE SCHEMA %s.%s", quoteIdentifier(currentCatalog), quoteIdentifier(currentSchema))
+	}
+	if err := s.set(ctx, statement, restore); err != nil {
+		return err
+	}
+	// USE CATALOG switches to the default schema of the catalog, which is only known by querying it
+	s.catalog, s.schema = catalog, schema
+	return nil
+}
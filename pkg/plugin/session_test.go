@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeConnector is a stand-in of the Databricks connector recording the executed statements. Its sessions
+// are in the namespace catalog and schema.
+type fakeConnector struct {
+	mu         sync.Mutex
+	statements []string
+	catalog    string
+	schema     string
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{c: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+func (c *fakeConnector) record(statement string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, statement)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("not supported")
+}
+
+type fakeConn struct {
+	c *fakeConnector
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.c.record(query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.c.record(query)
+	return &fakeRows{columns: []string{"catalog", "schema"}, values: [][]driver.Value{{c.c.catalog, c.c.schema}}}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestUseNamespace(t *testing.T) {
+	const probe = "SELECT current_catalog(), current_schema()"
+	tests := []struct {
+		name           string
+		defaultCatalog string
+		defaultSchema  string
+		catalog        string
+		schema         string
+		want           []string
+	}{
+		{"default namespace", "main", "sales", "main", "sales", nil},
+		{"catalog of default namespace", "main", "sales", "main", "", nil},
+		{"other schema", "main", "sales", "", "finance", []string{"USE SCHEMA `main`.`finance`", "USE SCHEMA `main`.`sales`"}},
+		{"other catalog", "main", "sales", "dev", "", []string{"USE CATALOG `dev`", "USE SCHEMA `main`.`sales`"}},
+		{"unknown namespace", "", "", "main", "sales", []string{probe}},
+		{"unknown namespace other schema", "", "", "", "finance", []string{probe, "USE SCHEMA `main`.`finance`", "USE SCHEMA `main`.`sales`"}},
+		{"no namespace", "main", "sales", "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := &fakeConnector{catalog: "main", schema: "sales"}
+			d := &Datasource{connectionSettings: ConnectionSettings{MaxIdleConns: 1}}
+			e := newEndpoint(d, "/sql/1.0/warehouses/abc", connector)
+			defer e.close()
+
+			ctx := context.Background()
+			conn, err := e.db.Conn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &querySession{d: d, e: e, conn: conn, release: func() {}, catalog: tt.defaultCatalog, schema: tt.defaultSchema}
+			e.inFlight.Add(1)
+			if err := s.useNamespace(ctx, tt.catalog, tt.schema); err != nil {
+				t.Fatal(err)
+			}
+			s.Close(ctx)
+
+			if !reflect.DeepEqual(connector.statements, tt.want) {
+				t.Errorf("expected statements %q, got %q", tt.want, connector.statements)
+			}
+		})
+	}
+}
+
+func TestUseNamespaceWithoutCurrentSchema(t *testing.T) {
+	connector := &fakeConnector{catalog: "hive_metastore"}
+	d := &Datasource{connectionSettings: ConnectionSettings{MaxIdleConns: 1}}
+	e := newEndpoint(d, "/sql/1.0/warehouses/abc", connector)
+	defer e.close()
+
+	ctx := context.Background()
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &querySession{d: d, e: e, conn: conn, release: func() {}}
+	e.inFlight.Add(1)
+	if err := s.useNamespace(ctx, "main", "sales"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close(ctx)
+
+	want := []string{"SELECT current_catalog(), current_schema()", "USE SCHEMA `main`.`sales`", "USE CATALOG `hive_metastore`"}
+	if !reflect.DeepEqual(connector.statements, want) {
+		t.Errorf("expected statements %q, got %q", want, connector.statements)
+	}
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"net/http"
+	"time"
+)
+
+// oauthClientTimeout is the timeout of token requests of the OAuth authenticators.
+const oauthClientTimeout = 30 * time.Second
+
+// newTLSConfig returns the TLS configuration of the datasource, used by the connector, the token requests
+// of the OAuth authenticators and the TLS step of the health check. The custom CA bundle is added to the
+// system roots, so a TLS-intercepting proxy with a private CA can be trusted.
+func newTLSConfig(settings *DatasourceSettings, secureSettings map[string]string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch settings.TLSMinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("invalid tls min version: %s, must be 1.2 or 1.3", settings.TLSMinVersion)
+	}
+
+	if caCert := secureSettings["tlsCACert"]; caCert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			log.DefaultLogger.Info("System cert pool not available, only the custom CA is trusted", "err", err)
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("tls ca cert contains no valid PEM encoded certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	clientCert, clientKey := secureSettings["tlsClientCert"], secureSettings["tlsClientKey"]
+	if clientCert != "" || clientKey != "" {
+		if err := validateConnectionSetting(clientCert, "TLS Client Cert"); err != nil {
+			return nil, err
+		}
+		if err := validateConnectionSetting(clientKey, "TLS Client Key"); err != nil {
+			return nil, err
+		}
+		cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		if err != nil {
+			return nil, fmt.Errorf("tls client cert and key are invalid: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if settings.TLSSkipVerify {
+		log.DefaultLogger.Warn("TLS certificate verification is disabled, only use this for development", "hostname", settings.Hostname)
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+// newOAuthClient returns the HTTP client of the token requests of the OAuth authenticators.
+func newOAuthClient(tlsConfig *tls.Config, proxy *proxySettings) (*http.Client, error) {
+	transport, err := newHTTPTransport(tlsConfig, proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   oauthClientTimeout,
+	}, nil
+}
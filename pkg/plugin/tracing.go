@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"context"
+	"github.com/databricks/databricks-sql-go/driverctx"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attribute keys used across the query pipeline
+const (
+	attributeRefID         = attribute.Key("grafana.ref_id")
+	attributeStatementID   = attribute.Key("databricks.statement_id")
+	attributeStatements    = attribute.Key("databricks.statements")
+	attributeRows          = attribute.Key("databricks.rows")
+	attributeQueries       = attribute.Key("grafana.queries")
+	attributeDatasourceUID = attribute.Key("grafana.datasource_uid")
+	attributeHTTPPath      = attribute.Key("databricks.http_path")
+)
+
+// startSpan starts a new span as child of the span in ctx. The SDK extracts the trace context of
+// Grafana's incoming request, so spans of the plugin are part of the same trace as the panel request.
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.DefaultTracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		_ = tracing.Error(span, err)
+	}
+	span.End()
+}
+
+// withStatementID registers a callback, which adds the Databricks statement ID to the span as soon as
+// the driver knows it. The returned function returns the statement ID once the statement was executed.
+func withStatementID(ctx context.Context, span trace.Span) (context.Context, func() string) {
+	var statementID string
+	ctx = driverctx.NewContextWithQueryIdCallback(ctx, func(id string) {
+		statementID = id
+		span.SetAttributes(attributeStatementID.String(id))
+	})
+	return ctx, func() string { return statementID }
+}
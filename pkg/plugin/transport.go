@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// newHTTPTransport returns the HTTP transport used by the connector, with the same settings as the
+// pooled transport of the driver and the TLS and proxy settings of the datasource.
+func newHTTPTransport(tlsConfig *tls.Config, proxy *proxySettings) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       180 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConnsPerHost:   10,
+		MaxConnsPerHost:       100,
+		TLSClientConfig:       tlsConfig.Clone(),
+	}
+	if err := proxy.configure(transport); err != nil {
+		return nil, fmt.Errorf("proxy could not be configured: %w", err)
+	}
+	return transport, nil
+}
+
+// cloudFetchSupported returns false if the connection depends on TLS or proxy settings of the datasource.
+// Cloud fetch downloads result files with the default HTTP client, which would bypass these settings.
+func cloudFetchSupported(tlsConfig *tls.Config, proxy *proxySettings) bool {
+	if proxy.customized() {
+		return false
+	}
+	return tlsConfig == nil || (tlsConfig.RootCAs == nil && len(tlsConfig.Certificates) == 0 &&
+		!tlsConfig.InsecureSkipVerify && tlsConfig.MinVersion <= tls.VersionTLS12)
+}
+
+// retryAfterMinWait is the minimum wait before a request is sent again, so Retry-After: 0 does not
+// result in a busy loop.
+const retryAfterMinWait = time.Second
+
+// retryAfterTransport handles HTTP 429 and 503 responses with a Retry-After header. It waits the requested
+// time and sends the request again, as long as the wait fits into the remaining time of the query (or the
+// rest of maxWait without a deadline). Otherwise it fails immediately with a rate limited error, instead of
+// retrying until the query times out.
+type retryAfterTransport struct {
+	base    http.RoundTripper
+	uid     string
+	maxWait time.Duration
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var waited time.Duration
+	for {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+			return resp, err
+		}
+		wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			// Without Retry-After the retries of the driver apply
+			return resp, nil
+		}
+		if wait < retryAfterMinWait {
+			wait = retryAfterMinWait
+		}
+
+		ctx := req.Context()
+		budget := t.maxWait - waited
+		if deadline, ok := ctx.Deadline(); ok {
+			budget = time.Until(deadline)
+		}
+		if wait > budget {
+			observeRateLimit(t.uid, rateLimitOutcomeRejected)
+			markRateLimited(ctx, fmt.Errorf("rate limited by Databricks (status %d), Retry-After of %s exceeds the remaining time of the query (%s)",
+				resp.StatusCode, wait, max(budget, 0).Round(time.Second)))
+			return rateLimitRejection(req, resp), nil
+		}
+
+		observeRateLimit(t.uid, rateLimitOutcomeWaited)
+		drainBody(resp)
+		loggerFromContext(ctx).Debug("Rate limited by Databricks, waiting for Retry-After", "status", resp.StatusCode, "wait", wait.String())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		waited += wait
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// rateLimitRejection replaces a rate limited response, which the retry policy of the driver would retry,
+// by a 408 response, which fails the request immediately. The rate limit marker of the statement keeps
+// the actual cause.
+func rateLimitRejection(req *http.Request, resp *http.Response) *http.Response {
+	drainBody(resp)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s (rate limited, Retry-After exceeds the remaining time)", http.StatusRequestTimeout, http.StatusText(http.StatusRequestTimeout)),
+		StatusCode:    http.StatusRequestTimeout,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        http.Header{},
+		Body:          http.NoBody,
+		ContentLength: 0,
+		Request:       req,
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func drainBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+}
+
+// rateLimitMarker remembers that a statement was rate limited. The driver retries failed requests and
+// may end with a context error, the marker keeps the rate limit as cause of the failure.
+type rateLimitMarker struct {
+	mu  sync.Mutex
+	err error
+}
+
+type rateLimitMarkerKey struct{}
+
+func withRateLimitMarker(ctx context.Context) (context.Context, *rateLimitMarker) {
+	marker := &rateLimitMarker{}
+	return context.WithValue(ctx, rateLimitMarkerKey{}, marker), marker
+}
+
+func markRateLimited(ctx context.Context, err error) {
+	if marker, ok := ctx.Value(rateLimitMarkerKey{}).(*rateLimitMarker); ok {
+		marker.mu.Lock()
+		defer marker.mu.Unlock()
+		marker.err = err
+	}
+}
+
+// wrap returns err as rate limited error, if the statement was rate limited.
+func (m *rateLimitMarker) wrap(err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil || m.err == nil || classifyError(err) == errorCategoryRateLimited {
+		return err
+	}
+	return newQueryError(errorCategoryRateLimited, fmt.Errorf("%s: %w", m.err, err))
+}
@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/proxy"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCloudFetchSupported(t *testing.T) {
+	explicitProxy := &proxySettings{
+		proxyURL: func(*http.Request) (*url.URL, error) { return url.Parse("http://proxy:3128") },
+		explicit: true,
+	}
+	secureSocks := &proxySettings{
+		proxyURL:    http.ProxyFromEnvironment,
+		secureSocks: proxy.New(&proxy.Options{Enabled: true, ClientCfg: &proxy.ClientCfg{}}),
+	}
+	secureSocksNotConfigured := &proxySettings{
+		proxyURL:    http.ProxyFromEnvironment,
+		secureSocks: proxy.New(&proxy.Options{Enabled: true}),
+	}
+
+	tests := []struct {
+		name      string
+		tlsConfig *tls.Config
+		proxy     *proxySettings
+		want      bool
+	}{
+		{"defaults", &tls.Config{MinVersion: tls.VersionTLS12}, &proxySettings{proxyURL: http.ProxyFromEnvironment}, true},
+		{"no settings", nil, nil, true},
+		{"custom ca", &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: x509.NewCertPool()}, nil, false},
+		{"client certificate", &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{{}}}, nil, false},
+		{"skip verify", &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: true}, nil, false},
+		{"tls 1.3", &tls.Config{MinVersion: tls.VersionTLS13}, nil, false},
+		{"proxy url", &tls.Config{MinVersion: tls.VersionTLS12}, explicitProxy, false},
+		{"secure socks proxy", &tls.Config{MinVersion: tls.VersionTLS12}, secureSocks, false},
+		{"secure socks proxy not configured in grafana", &tls.Config{MinVersion: tls.VersionTLS12}, secureSocksNotConfigured, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cloudFetchSupported(tt.tlsConfig, tt.proxy); got != tt.want {
+				t.Errorf("expected cloud fetch %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
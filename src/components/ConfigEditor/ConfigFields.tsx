@@ -1,6 +1,6 @@
 // ConfigFields.tsx
 import React from 'react';
-import {InlineField, Input, SecretInput, Select} from '@grafana/ui';
+import {Button, InlineField, InlineSwitch, Input, SecretInput, Select} from '@grafana/ui';
 
 export const ConfigInputField = ({ label, tooltip, value, placeholder, onChange }: any) => (
     <InlineField label={label} labelWidth={30} tooltip={tooltip}>
@@ -33,3 +33,61 @@ export const ConfigSecretInputField = ({ label, tooltip, value, placeholder, isC
         />
     </InlineField>
 );
+
+export const ConfigSwitchField = ({ label, tooltip, value, onChange }: any) => (
+    <InlineField label={label} labelWidth={30} tooltip={tooltip}>
+        <InlineSwitch
+            value={value}
+            onChange={(event: React.FormEvent<HTMLInputElement>) => onChange(event.currentTarget.checked)}
+        />
+    </InlineField>
+);
+
+// ConfigKeyValueField edits a string map as a list of key/value rows, rows are kept in insertion order.
+export const ConfigKeyValueField = ({ label, tooltip, value, keyPlaceholder, valuePlaceholder, onChange }: any) => {
+    const entries = Object.entries((value || {}) as Record<string, string>);
+    const update = (updated: Array<[string, string]>) => onChange(Object.fromEntries(updated));
+
+    return (
+        <InlineField label={label} labelWidth={30} tooltip={tooltip}>
+            <div style={{display: 'flex', flexDirection: 'column', gap: '4px'}}>
+                {entries.map(([key, entryValue], index) => (
+                    <div key={index} style={{display: 'flex', gap: '4px'}}>
+                        <Input
+                            value={key}
+                            placeholder={keyPlaceholder}
+                            width={19}
+                            onChange={(event: React.ChangeEvent<HTMLInputElement>) =>
+                                update(entries.map((entry, i) => (i === index ? [event.target.value, entry[1]] : entry)))
+                            }
+                        />
+                        <Input
+                            value={entryValue}
+                            placeholder={valuePlaceholder}
+                            width={19}
+                            onChange={(event: React.ChangeEvent<HTMLInputElement>) =>
+                                update(entries.map((entry, i) => (i === index ? [entry[0], event.target.value] : entry)))
+                            }
+                        />
+                        <Button
+                            aria-label="Remove"
+                            type="button"
+                            icon="trash-alt"
+                            variant="secondary"
+                            onClick={() => update(entries.filter((_, i) => i !== index))}
+                        />
+                    </div>
+                ))}
+                <Button
+                    aria-label="Add"
+                    type="button"
+                    icon="plus"
+                    variant="secondary"
+                    style={{alignSelf: 'flex-start'}}
+                    disabled={entries.some(([key]) => key === '')}
+                    onClick={() => update([...entries, ['', '']])}
+                />
+            </div>
+        </InlineField>
+    );
+};
@@ -29,7 +29,7 @@ export function SqlQueryEditor({
     const [isQueryRunnable, setIsQueryRunnable] = useState(true);
     const db = datasource.getDB();
 
-    let {defaultSchema, defaultCatalog, unityCatalogEnabled, defaultQueryFormat, defaultEditorMode} = datasource;
+    let {defaultSchema, defaultCatalog, unityCatalogEnabled, defaultQueryFormat, defaultEditorMode, warehouses} = datasource;
     const dialect = queryHeaderProps?.dialect ?? 'other';
     const {loading, error} = useAsync(async () => {
         return () => {
@@ -95,6 +95,7 @@ export function SqlQueryEditor({
                 db={db}
                 preconfiguredCatalog={defaultCatalog}
                 preconfiguredSchema={defaultSchema}
+                warehouses={warehouses}
                 onChange={onQueryHeaderChange}
                 onRunQuery={onRunQuery}
                 onQueryRowChange={setQueryRowFilter}
@@ -26,6 +26,7 @@ export interface QueryHeaderProps {
     preconfiguredSchema: string | undefined;
     query: QueryWithDefaults;
     queryRowFilter: QueryRowFilter;
+    warehouses: string[];
 }
 
 const editorModes = [
@@ -44,6 +45,7 @@ export function QueryHeader({
                                 preconfiguredSchema,
                                 query,
                                 queryRowFilter,
+                                warehouses,
                             }: QueryHeaderProps) {
     const {editorMode} = query;
     const [_, copyToClipboard] = useCopyToClipboard();
@@ -138,6 +140,11 @@ export function QueryHeader({
             .catch(console.error);
     }, []);
 
+    const warehouseSelectOptions = [
+        {label: 'Default', value: '', description: 'HTTP path of the datasource'},
+        ...warehouses.map((warehouse) => ({label: warehouse, value: warehouse})),
+    ];
+
     const fillModeSelectOptions = [
         {
             label: 'Previous',
@@ -160,6 +167,44 @@ export function QueryHeader({
                     options={QUERY_FORMAT_OPTIONS}
                 />
 
+                {warehouses.length > 0 && (
+                    <InlineSelect
+                        label="Warehouse"
+                        value={query.warehouse || ''}
+                        menuShouldPortal
+                        onChange={(e: SelectableValue) => onChange({...query, warehouse: e.value || undefined})}
+                        options={warehouseSelectOptions}
+                    />
+                )}
+
+                <InlineField label="Timeout" tooltip="Timeout of this query in seconds, capped by the datasource. Empty uses the datasource default.">
+                    <Input
+                        type="number"
+                        min={0}
+                        value={query.timeout || ''}
+                        width={10}
+                        placeholder="default"
+                        onChange={(event: React.FormEvent<HTMLInputElement>) => {
+                            const timeout = Number.parseInt(event.currentTarget.value, 10);
+                            onChange({...query, timeout: timeout > 0 ? timeout : undefined});
+                        }}
+                    />
+                </InlineField>
+
+                <InlineField label="Max Rows" tooltip="Row limit of this query, capped by the datasource. Empty uses the datasource default.">
+                    <Input
+                        type="number"
+                        min={0}
+                        value={query.maxRows || ''}
+                        width={10}
+                        placeholder="default"
+                        onChange={(event: React.FormEvent<HTMLInputElement>) => {
+                            const maxRows = Number.parseInt(event.currentTarget.value, 10);
+                            onChange({...query, maxRows: maxRows > 0 ? maxRows : undefined});
+                        }}
+                    />
+                </InlineField>
+
                 {editorMode === EditorMode.Builder && (
                     <>
                         <InlineSwitch
@@ -67,6 +67,7 @@ export abstract class SqlDatasource extends DataSourceWithBackend<SQLQuery, SQLO
   initialized: boolean;
   defaultQueryFormat: QueryFormat;
   defaultEditorMode: EditorMode;
+  warehouses: string[];
 
   constructor(
     instanceSettings: DataSourceInstanceSettings<SQLOptions>,
@@ -86,6 +87,7 @@ export abstract class SqlDatasource extends DataSourceWithBackend<SQLQuery, SQLO
     this.initialized = false;
     this.defaultQueryFormat = settingsData.defaultQueryFormat;
     this.defaultEditorMode = settingsData.defaultEditorMode;
+    this.warehouses = Object.keys(settingsData.warehouses ?? {}).sort();
     /*
       The `settingsData.database` will be defined if a default database has been defined in either
       1) the ConfigurationEditor.tsx, OR 2) the provisioning config file, either under `jsondata.database`, or simply `database`.
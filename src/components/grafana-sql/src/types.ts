@@ -46,6 +46,8 @@ export interface SQLOptions extends SQLConnectionLimits, DataSourceJsonData {
   timeInterval: string;
   defaultQueryFormat: QueryFormat;
   defaultEditorMode: EditorMode;
+  // Allowlist of named SQL warehouses (name to HTTP path) a query can select
+  warehouses?: Record<string, string>;
 }
 
 export enum QueryFormat {
@@ -69,6 +71,11 @@ export interface SQLQuery extends DataQuery {
   editorMode?: EditorMode;
   rawQuery?: boolean;
   querySettings?: QuerySettings;
+  // Named SQL warehouse of the allowlist of the datasource
+  warehouse?: string;
+  // Overrides of the datasource timeout (seconds) and row limit for this query
+  timeout?: number;
+  maxRows?: number;
   // Deprecated: kept for backward compatibility
   rawSqlQuery?: string;
 }
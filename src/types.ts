@@ -7,16 +7,46 @@ export interface DatabricksDataSourceOptions extends SQLOptions {
   hostname?: string;
   port?: string;
   path?: string;
+  additionalPaths?: string;
+  pathStrategy?: string;
   authenticationMethod?: string;
   clientId?: string;
   externalCredentialsUrl?: string;
   oauthScopes?: string;
+  oauthAudience?: string;
+  oauthResource?: string;
+  oauthAuthStyle?: string;
+  tokenFile?: string;
+  tenantId?: string;
+  tokenExchangeAudience?: string;
+  subjectTokenType?: string;
   retries?: string;
   retryBackoff?: string;
   maxRetryDuration?: string;
   timeout?: string;
   maxRows?: string;
+  maxQueryTimeout?: string;
+  maxQueryRows?: string;
+  maxConcurrentQueries?: string;
+  maxQueuedQueries?: string;
+  queueTimeout?: string;
+  circuitBreakerThreshold?: string;
+  circuitBreakerTimeout?: string;
   oauthPassThru?: boolean;
+  defaultCatalog?: string;
+  defaultSchema?: string;
+  sessionParameters?: Record<string, string>;
+  logSql?: boolean;
+  queryAttribution?: boolean;
+  demoMode?: string;
+  fixturesPath?: string;
+  replayTimeShift?: boolean;
+  tlsMinVersion?: string;
+  tlsSkipVerify?: boolean;
+  proxyUrl?: string;
+  proxyUsername?: string;
+  noProxy?: string;
+  enableSecureSocksProxy?: boolean;
 }
 
 /**
@@ -25,6 +55,13 @@ export interface DatabricksDataSourceOptions extends SQLOptions {
 export interface DatabricksSecureJsonData {
   token?: string;
   clientSecret?: string;
+  clientPrivateKey?: string;
+  clientCertificate?: string;
+  gcpServiceAccountKey?: string;
+  tlsCACert?: string;
+  tlsClientCert?: string;
+  tlsClientKey?: string;
+  proxyPassword?: string;
 }
 
 export type ColumnResponse = {